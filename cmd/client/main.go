@@ -1,297 +1,731 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net"
-	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"claude-pty/internal"
+	"claude-pty/pkg/client"
+	"claude-pty/pkg/mcp"
 	"golang.org/x/term"
 )
 
-var socketPath = flag.String("socket", internal.GetDefaultSocketPath(), "Unix socket path")
+var (
+	socketPath = flag.String("socket", internal.GetDefaultSocketPath(), "Unix socket path")
+	serverURL  = flag.String("url", os.Getenv("CLAUDE_PTY_URL"), "Server URL for the TCP listener (e.g. https://host:7681); overrides -socket")
+	token      = flag.String("token", os.Getenv("CLAUDE_PTY_TOKEN"), "Bearer token for -url")
+	caFile     = flag.String("ca", os.Getenv("CLAUDE_PTY_CA"), "CA certificate to verify the server with -url (PEM)")
+	raw        = flag.Bool("raw", false, "Show output without secret redaction (admin only, audited)")
+)
+
+// newClient 根据参数创建 Unix socket 或 TCP 客户端
+func newClient() (*client.Client, error) {
+	if *serverURL == "" {
+		return client.New(*socketPath), nil
+	}
 
-// unixClient HTTP 客户端，使用 Unix socket
-type unixClient struct {
-	socketPath string
+	var tlsConfig *tls.Config
+	if *caFile != "" {
+		pem, err := os.ReadFile(*caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", *caFile)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+	return client.NewRemote(*serverURL, *token, tlsConfig), nil
 }
 
-func (c *unixClient) do(action, sessionID, cwd, text, status string, limit ...int) (*internal.Response, error) {
-	lim := 0
-	if len(limit) > 0 {
-		lim = limit[0]
+func cmdCreate(c *client.Client, args []string) {
+	cwd := ""
+	if len(args) > 0 {
+		cwd = args[0]
 	}
 
-	return c.doRaw(internal.Request{
-		Action:    action,
-		SessionID: sessionID,
-		CWD:       cwd,
-		Text:      text,
-		Status:    status,
-		Limit:     lim,
-	})
+	session, err := c.Create(context.Background(), client.CreateOptions{CWD: cwd})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Session created: %s\n", session.ID)
+	fmt.Printf("Working directory: %s\n", session.CWD)
 }
 
-func (c *unixClient) doRaw(reqBody internal.Request) (*internal.Response, error) {
-	body, err := json.Marshal(reqBody)
+func cmdList(c *client.Client) {
+	sessions, err := c.List(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	// 使用 Unix socket 创建 HTTP 请求
-	url := "http://localhost/"
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(body)))
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+	if len(sessions) == 0 {
+		fmt.Println("No sessions")
+		return
 	}
 
-	// 创建 Unix 传输
-	transport := &http.Transport{
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			dialer := &net.Dialer{}
-			return dialer.DialContext(context.Background(), "unix", c.socketPath)
-		},
+	fmt.Printf("%-36s %-20s %-15s %-10s\n", "ID", "CWD", "Status", "Tokens")
+	fmt.Println(strings.Repeat("-", 86))
+	for _, s := range sessions {
+		tokens := "-"
+		if s.Usage != nil {
+			tokens = fmt.Sprintf("%d", s.Usage.Total.TotalTokens())
+		}
+		fmt.Printf("%-36s %-20s %-15s %-10s\n", s.ID, s.CWD, s.Status, tokens)
 	}
+}
 
-	client := &http.Client{Transport: transport}
-	resp, err := client.Do(req)
+func cmdGet(c *client.Client, sessionID string, limitStr string) {
+	output, err := c.Output(context.Background(), sessionID, limitStr)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+	if output != "" {
+		fmt.Print(output)
 	}
+}
 
-	var result internal.Response
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+func cmdInput(c *client.Client, sessionID, text string) {
+	if err := c.Input(context.Background(), sessionID, text); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	return &result, nil
+	fmt.Println("Input sent")
 }
 
-func (c *unixClient) list() (*internal.Response, error) {
-	// 使用 Unix socket 创建 HTTP 请求
-	url := "http://localhost/list"
-	req, err := http.NewRequest("GET", url, nil)
+func cmdKey(c *client.Client, sessionID string, keys []string) {
+	if err := c.SendKeys(context.Background(), sessionID, keys...); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Keys sent")
+}
+
+func cmdSubmit(c *client.Client, sessionID, text string) {
+	// "-" 表示从 stdin 读取（适合多行 prompt）
+	if text == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: read stdin: %v\n", err)
+			os.Exit(1)
+		}
+		text = string(data)
+	}
+
+	status, err := c.Submit(context.Background(), sessionID, text, 0)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	// 创建 Unix 传输
-	transport := &http.Transport{
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			dialer := &net.Dialer{}
-			return dialer.DialContext(context.Background(), "unix", c.socketPath)
-		},
+	fmt.Printf("Prompt submitted (status: %s)\n", status)
+}
+
+func cmdInterrupt(c *client.Client, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: claude-pty interrupt <session_id> [--force]")
+		os.Exit(1)
 	}
 
-	client := &http.Client{Transport: transport}
-	resp, err := client.Do(req)
+	force := len(args) > 1 && args[1] == "--force"
+	status, err := c.Interrupt(context.Background(), args[0], force)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	fmt.Printf("Interrupted (status: %s)\n", status)
+}
+
+func cmdPermission(c *client.Client, sessionID, decision string) {
+	status, err := c.RespondPermission(context.Background(), sessionID, decision)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Permission %s (status: %s)\n", decision, status)
+}
+
+func cmdEnqueue(c *client.Client, sessionID, text string) {
+	if text == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: read stdin: %v\n", err)
+			os.Exit(1)
+		}
+		text = string(data)
 	}
 
-	var result internal.Response
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	queue, err := c.Enqueue(context.Background(), sessionID, text)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	return &result, nil
+	fmt.Printf("Prompt queued (%d pending)\n", len(queue))
 }
 
-func cmdCreate(client *unixClient, args []string) {
-	cwd := ""
-	if len(args) > 0 {
-		cwd = args[0]
+func cmdQueue(c *client.Client, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: claude-pty queue <session_id> [clear]")
+		os.Exit(1)
 	}
 
-	resp, err := client.do("create", "", cwd, "", "")
+	ctx := context.Background()
+	if len(args) > 1 && args[1] == "clear" {
+		if err := c.ClearQueue(ctx, args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Queue cleared")
+		return
+	}
+
+	queue, err := c.Queue(ctx, args[0])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if !resp.Success {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+	if len(queue) == 0 {
+		fmt.Println("Queue empty")
+		return
+	}
+	for i, text := range queue {
+		fmt.Printf("%d. %s\n", i+1, text)
+	}
+}
+
+func cmdBudget(c *client.Client, sessionID, tokens string) {
+	var budget int64
+	if _, err := fmt.Sscanf(tokens, "%d", &budget); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid token budget: %s\n", tokens)
+		os.Exit(1)
+	}
+
+	if err := c.SetBudget(context.Background(), sessionID, budget); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Session created: %s\n", resp.Session.ID)
-	fmt.Printf("Working directory: %s\n", resp.Session.CWD)
+	fmt.Println("Token budget updated")
 }
 
-func cmdList(client *unixClient) {
-	resp, err := client.list()
-	if err != nil {
+func cmdDelete(c *client.Client, sessionID string) {
+	if err := c.Delete(context.Background(), sessionID); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if !resp.Success {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+	fmt.Println("Session deleted")
+}
+
+func cmdLog(c *client.Client, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: claude-pty log <session_id> [limit] [-f] [--thinking] [--tree]")
 		os.Exit(1)
 	}
 
-	if len(resp.Sessions) == 0 {
-		fmt.Println("No sessions")
+	sessionID := args[0]
+	limit := 0
+	follow := false
+	thinking := false
+	tree := false
+	for _, arg := range args[1:] {
+		switch arg {
+		case "-f", "--follow":
+			follow = true
+		case "--thinking":
+			thinking = true
+		case "--tree":
+			tree = true
+		default:
+			fmt.Sscanf(arg, "%d", &limit)
+		}
+	}
+
+	// 调用 server 的 messages API
+	ctx := context.Background()
+	messages, cursor, err := c.Messages(ctx, sessionID, client.MessagesOptions{Limit: limit, Thinking: thinking, Tree: tree})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if tree {
+		printMessageTree(messages, "")
 		return
 	}
 
-	fmt.Printf("%-36s %-20s %-15s\n", "ID", "CWD", "Status")
-	fmt.Println(strings.Repeat("-", 75))
-	for _, s := range resp.Sessions {
-		fmt.Printf("%-36s %-20s %-15s\n", s.ID, s.CWD, s.Status)
+	printMessages(messages)
+	if !follow {
+		return
+	}
+
+	// 使用游标只读取新增的消息
+	for {
+		time.Sleep(time.Second)
+		messages, cursor, err = c.Messages(ctx, sessionID, client.MessagesOptions{Cursor: cursor, Thinking: thinking})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printMessages(messages)
 	}
 }
 
-func cmdGet(client *unixClient, sessionID string, limitStr string) {
-	reqBody := internal.Request{
-		Action:    "get",
-		SessionID: sessionID,
-		LimitStr:  limitStr,
+func cmdExport(c *client.Client, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "markdown", "Output format: markdown or html")
+	output := fs.String("o", "", "Write to file instead of stdout")
+	thinking := fs.Bool("thinking", false, "Include thinking blocks")
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: claude-pty export <session_id> [--format markdown|html] [-o file] [--thinking]")
+		os.Exit(1)
 	}
-	resp, err := client.doRaw(reqBody)
+	fs.Parse(args[1:])
+
+	content, err := c.Export(context.Background(), args[0], *format, *thinking)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if !resp.Success {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+	if *output == "" {
+		fmt.Print(content)
+		return
+	}
+	if err := os.WriteFile(*output, []byte(content), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	fmt.Printf("Exported to %s\n", *output)
+}
 
-	if resp.Output != "" {
-		fmt.Print(resp.Output)
+func cmdSearch(c *client.Client, args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	regex := fs.Bool("regex", false, "Treat query as a regular expression")
+	tool := fs.String("tool", "", "Only match calls of this tool (supports *)")
+	path := fs.String("path", "", "Only match tool calls on this file (suffix or glob)")
+	session := fs.String("session", "", "Only search this session")
+	all := fs.Bool("all", false, "Search every transcript in ~/.claude/projects")
+	limit := fs.Int("limit", 0, "Maximum number of results")
+
+	// 查询文本可以放在参数前面
+	query := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		query, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if query == "" {
+		query = fs.Arg(0)
+	}
+	if query == "" && *tool == "" && *path == "" {
+		fmt.Fprintln(os.Stderr, "Usage: claude-pty search [query] [--regex] [--tool name] [--path file] [--session id] [--all] [--limit n]")
+		os.Exit(1)
 	}
-}
 
-func cmdInput(client *unixClient, sessionID, text string) {
-	resp, err := client.do("input", sessionID, "", text, "")
+	results, err := c.Search(context.Background(), client.SearchOptions{
+		Query:       query,
+		Regex:       *regex,
+		Tool:        *tool,
+		Path:        *path,
+		SessionID:   *session,
+		AllProjects: *all,
+		Limit:       *limit,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if !resp.Success {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+	if len(results) == 0 {
+		fmt.Println("No matches")
+		return
+	}
+	for _, r := range results {
+		id := r.SessionID
+		if id == "" {
+			id = "(" + r.ClaudeSessionID + ")"
+		}
+		kind := r.Type
+		if r.ToolName != "" {
+			kind += ":" + r.ToolName
+		}
+		fmt.Printf("%s  %s  %s\n    %s\n", id, r.UUID, kind, r.Snippet)
+	}
+}
+
+func cmdChanges(c *client.Client, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: claude-pty changes <session_id> [--diff] [path]")
 		os.Exit(1)
 	}
 
-	fmt.Println("Input sent")
-}
+	sessionID := args[0]
+	diff := false
+	path := ""
+	for _, arg := range args[1:] {
+		if arg == "--diff" {
+			diff = true
+		} else {
+			path = arg
+		}
+	}
 
-func cmdDelete(client *unixClient, sessionID string) {
-	resp, err := client.do("delete", sessionID, "", "", "")
+	changes, err := c.Changes(context.Background(), sessionID, diff, path)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if !resp.Success {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+	if !diff {
+		if len(changes) == 0 {
+			fmt.Println("No changes")
+			return
+		}
+		fmt.Printf("%-8s %-6s %s\n", "ACTION", "EDITS", "PATH")
+		for _, change := range changes {
+			fmt.Printf("%-8s %-6d %s\n", change.Action, change.Edits, change.Path)
+		}
+		return
+	}
+
+	for _, change := range changes {
+		if change.DiffError != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", change.Path, change.DiffError)
+			continue
+		}
+		fmt.Print(change.Diff)
+	}
+}
+
+func cmdTodos(c *client.Client, sessionID string) {
+	todos, err := c.Todos(context.Background(), sessionID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("Session deleted")
+	if todos == nil {
+		fmt.Println("No todos")
+		return
+	}
+	fmt.Printf("%d/%d done\n", todos.Completed, todos.Total)
+	for _, todo := range todos.Todos {
+		mark := " "
+		switch todo.Status {
+		case "completed":
+			mark = "x"
+		case "in_progress":
+			mark = "~"
+		}
+		fmt.Printf("[%s] %s\n", mark, todo.Content)
+	}
 }
 
-func cmdLog(client *unixClient, args []string) {
+func cmdResult(c *client.Client, args []string) {
+	fs := flag.NewFlagSet("result", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Extract the JSON block from the reply")
+	schemaFile := fs.String("schema", "", "Validate the extracted JSON against a JSON Schema file")
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: claude-pty log <session_id> [limit]")
+		fmt.Fprintln(os.Stderr, "Usage: claude-pty result <session_id> [--json] [--schema file]")
 		os.Exit(1)
 	}
+	fs.Parse(args[1:])
 
-	sessionID := args[0]
-	limit := 0
-	if len(args) > 1 {
-		fmt.Sscanf(args[1], "%d", &limit)
+	var schema json.RawMessage
+	if *schemaFile != "" {
+		data, err := os.ReadFile(*schemaFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		schema = data
 	}
 
-	// 调用 server 的 messages API
-	resp, err := client.do("messages", sessionID, "", "", "", limit)
+	result, err := c.Result(context.Background(), args[0], *asJSON, schema)
+	if err != nil {
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) && apiErr.Response != nil && len(apiErr.Response.ValidationErrors) > 0 {
+			fmt.Fprintln(os.Stderr, "Error: schema validation failed")
+			for _, e := range apiErr.Response.ValidationErrors {
+				fmt.Fprintf(os.Stderr, "  %s\n", e)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+
+	if len(result.JSON) == 0 {
+		fmt.Println(result.Output)
+		return
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, result.JSON, "", "  "); err != nil {
+		fmt.Println(string(result.JSON))
+		return
+	}
+	fmt.Println(pretty.String())
+}
+
+func cmdAudit(c *client.Client, args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	since := fs.Duration("since", 0, "Only entries from the last duration (e.g. 1h)")
+	limit := fs.Int("limit", 0, "Maximum number of entries (default 100)")
+
+	sessionID := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sessionID, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+
+	var sinceTime time.Time
+	if *since > 0 {
+		sinceTime = time.Now().Add(-*since)
+	}
+	entries, err := c.Audit(context.Background(), sessionID, sinceTime, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No audit entries")
+		return
+	}
+	for _, e := range entries {
+		result := "ok"
+		if !e.Success {
+			result = string(e.Code)
+		}
+		caller := e.Caller
+		if e.UID != nil {
+			caller += fmt.Sprintf(" (uid %d)", *e.UID)
+		}
+		target := e.SessionID
+		if e.Tool != "" {
+			target += " " + e.Tool
+		}
+		fmt.Printf("%s  %-12s %-24s %-38s %s\n", e.Time, e.Action, caller, target, result)
+	}
+}
+
+func cmdQuotas(c *client.Client) {
+	usage, err := c.Quotas(context.Background())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if !resp.Success {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+	limit := func(n int) string {
+		if n <= 0 {
+			return "unlimited"
+		}
+		return strconv.Itoa(n)
+	}
+	fmt.Printf("Sessions: %d / %s\n", usage.Sessions, limit(usage.Limits.MaxSessions))
+	fmt.Printf("Per caller: %s sessions, %s creates/min\n", limit(usage.Limits.MaxSessionsPerCaller), limit(usage.Limits.CreatesPerMinute))
+	fmt.Printf("Max input: %s bytes\n", limit(usage.Limits.MaxInputBytes))
+	if len(usage.Callers) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf("%-24s %-10s %s\n", "CALLER", "SESSIONS", "CREATES/MIN")
+	for _, u := range usage.Callers {
+		fmt.Printf("%-24s %-10d %d\n", u.Caller, u.Sessions, u.CreatesLastMinute)
+	}
+}
+
+func cmdEvents(c *client.Client, args []string) {
+	sessionID := ""
+	if len(args) > 0 {
+		sessionID = args[0]
+	}
+
+	err := c.Events(context.Background(), sessionID, func(event *client.Event) error {
+		switch event.Type {
+		case "status":
+			fmt.Printf("[%s] status: %s\n", event.SessionID, event.Status)
+		case "message":
+			if sessionID == "" {
+				fmt.Printf("[%s]\n", event.SessionID)
+			}
+			printMessages([]*client.Message{event.Message})
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	// 显示消息
-	for _, msg := range resp.Messages {
+// printMessages 显示消息
+func printMessages(messages []*internal.Message) {
+	for _, msg := range messages {
 		switch msg.Type {
 		case "user":
 			fmt.Printf("\n[User]\n%s\n\n", msg.Content)
 		case "assistant":
 			fmt.Printf("[Claude]\n%s\n\n", msg.Content)
+		case "thinking":
+			fmt.Printf("[Thinking]\n%s\n\n", msg.Content)
 		case "tool":
 			fmt.Printf("[Tool]\n%s\n\n", msg.Content)
 		}
 	}
 }
 
-func cmdInfo(client *unixClient, sessionID string) {
-	resp, err := client.do("get_info", sessionID, "", "", "")
+// printMessageTree 显示消息树，subagent 的消息缩进显示在 Task 调用之后
+func printMessageTree(messages []*internal.Message, indent string) {
+	for _, msg := range messages {
+		var label string
+		switch msg.Type {
+		case "user":
+			label = "User"
+		case "assistant":
+			label = "Claude"
+		case "thinking":
+			label = "Thinking"
+		case "tool":
+			label = "Tool"
+		default:
+			continue
+		}
+		content := strings.ReplaceAll(msg.Content, "\n", "\n"+indent)
+		fmt.Printf("%s[%s]\n%s%s\n\n", indent, label, indent, content)
+		if len(msg.Subagent) > 0 {
+			printMessageTree(msg.Subagent, indent+"    ")
+		}
+	}
+}
+
+func cmdInfo(c *client.Client, sessionID string) {
+	session, err := c.Info(context.Background(), sessionID)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if !resp.Success {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+	if session != nil {
+		fmt.Printf("ID:              %s\n", session.ID)
+		if session.ClaudeSessionID != "" {
+			fmt.Printf("Claude Session: %s\n", session.ClaudeSessionID)
+		}
+		fmt.Printf("CWD:             %s\n", session.CWD)
+		fmt.Printf("Status:          %s\n", session.Status)
+		fmt.Printf("Created:         %s\n", session.CreatedAt)
+		fmt.Printf("Last Activity:   %s\n", session.LastActivity)
+		if len(session.Queue) > 0 {
+			fmt.Printf("Queued Prompts:  %d\n", len(session.Queue))
+		}
+		if session.ActiveSubagents > 0 {
+			fmt.Printf("Subagents:       %d running\n", session.ActiveSubagents)
+		}
+		if todos := session.Todos; todos != nil {
+			fmt.Printf("Todos:           %d/%d done\n", todos.Completed, todos.Total)
+		}
+		if usage := session.Usage; usage != nil {
+			fmt.Printf("Tokens:          %d (in %d, out %d, cache write %d, cache read %d)\n",
+				usage.Total.TotalTokens(), usage.Total.InputTokens, usage.Total.OutputTokens,
+				usage.Total.CacheCreationInputTokens, usage.Total.CacheReadInputTokens)
+			if usage.Total.CostUSD > 0 {
+				fmt.Printf("Est. Cost:       $%.4f\n", usage.Total.CostUSD)
+			}
+			if usage.Budget > 0 {
+				fmt.Printf("Token Budget:    %d\n", usage.Budget)
+			}
+			for model, u := range usage.ByModel {
+				fmt.Printf("  %-28s %d tokens\n", model, u.TotalTokens())
+			}
+		}
+	}
+}
+
+func cmdVersion(c *client.Client) {
+	fmt.Printf("Client API version: %d\n", internal.APIVersion)
+
+	version, minVersion, err := c.Version(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if resp.Session != nil {
-		fmt.Printf("ID:              %s\n", resp.Session.ID)
-		if resp.Session.ClaudeSessionID != "" {
-			fmt.Printf("Claude Session: %s\n", resp.Session.ClaudeSessionID)
-		}
-		fmt.Printf("CWD:             %s\n", resp.Session.CWD)
-		fmt.Printf("Status:          %s\n", resp.Session.Status)
-		fmt.Printf("Created:         %s\n", resp.Session.CreatedAt)
-		fmt.Printf("Last Activity:   %s\n", resp.Session.LastActivity)
+	fmt.Printf("Server API version: %d (supports %d-%d)\n", version, minVersion, version)
+	if internal.APIVersion < minVersion || internal.APIVersion > version {
+		fmt.Fprintln(os.Stderr, "Error: client API version not supported by server")
+		os.Exit(1)
 	}
 }
 
-func cmdStatus(client *unixClient, sessionID string) {
-	resp, err := client.do("get_status", sessionID, "", "", "")
+func cmdStatus(c *client.Client, sessionID string) {
+	status, err := c.Status(context.Background(), sessionID)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if !resp.Success {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+	fmt.Printf("Session %s status: %s\n", sessionID, status)
+}
+
+func cmdWait(c *client.Client, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: claude-pty wait <session_id> [timeout_seconds]")
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	if len(args) > 1 {
+		seconds, err := strconv.Atoi(args[1])
+		if err != nil || seconds <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid timeout: %s\n", args[1])
+			os.Exit(1)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+		defer cancel()
+	}
+
+	status, err := c.Wait(ctx, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v (status: %s)\n", err, status)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Session %s status: %s\n", sessionID, resp.Status)
+	fmt.Printf("Session %s status: %s\n", args[0], status)
+}
+
+func cmdMCP(c *client.Client) {
+	if err := mcp.NewServer(c).Serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 }
 
-func cmdConnect(client *unixClient, sessionID string) {
+func cmdConnect(c *client.Client, sessionID string) {
 	fmt.Printf("Connecting to session %s...\n", sessionID)
 	fmt.Println("Press Ctrl+Q to disconnect")
 
@@ -318,20 +752,24 @@ func cmdConnect(client *unixClient, sessionID string) {
 			case <-done:
 				return
 			case <-ticker.C:
-				resp, err := client.do("get", sessionID, "", "", "")
+				output, err := c.Output(context.Background(), sessionID, "")
 				if err != nil {
+					var apiErr *client.Error
+					if errors.As(err, &apiErr) {
+						continue
+					}
 					return
 				}
-				if !resp.Success || resp.Output == "" {
+				if output == "" {
 					continue
 				}
 				// 只打印新增的部分
-				if resp.Output == lastOutput {
+				if output == lastOutput {
 					continue
 				}
-				newContent := resp.Output
-				if strings.HasPrefix(resp.Output, lastOutput) {
-					newContent = resp.Output[len(lastOutput):]
+				newContent := output
+				if strings.HasPrefix(output, lastOutput) {
+					newContent = output[len(lastOutput):]
 				} else {
 					// 内容发生了变化（如清屏），全量输出
 					fmt.Print("\r\033[2J\033[H") // 清屏
@@ -339,7 +777,7 @@ func cmdConnect(client *unixClient, sessionID string) {
 				// raw mode 下 \n 需要转为 \r\n
 				newContent = strings.ReplaceAll(newContent, "\n", "\r\n")
 				fmt.Print(newContent)
-				lastOutput = resp.Output
+				lastOutput = output
 			}
 		}
 	}()
@@ -364,8 +802,7 @@ func cmdConnect(client *unixClient, sessionID string) {
 				close(done)
 				return
 			}
-			_, err = client.do("input", sessionID, "", string(buf[:n]), "")
-			if err != nil {
+			if err := c.Input(context.Background(), sessionID, string(buf[:n])); err != nil {
 				fmt.Fprintf(os.Stderr, "\r\nError: %v\r\n", err)
 			}
 		}
@@ -377,33 +814,57 @@ func main() {
 
 	args := flag.Args()
 	if len(args) < 1 {
-		fmt.Println("Usage: claude-pty <command> [arguments]")
+		fmt.Println("Usage: claude-pty [-raw] <command> [arguments]")
 		fmt.Println("Commands:")
 		fmt.Println("  create [cwd]          Create a new session")
 		fmt.Println("  list                  List all sessions")
 		fmt.Println("  connect <session_id>  Connect to a session interactively")
 		fmt.Println("  get <session_id> [limit]  Get output from a session")
 		fmt.Println("  input <session_id> <text>  Send input to a session")
+		fmt.Println("  key <session_id> <key>...  Send named keys (Enter, Escape, C-c, ...)")
+		fmt.Println("  submit <session_id> <text|->  Paste a prompt and press Enter")
+		fmt.Println("  interrupt <session_id> [--force]  Stop the current turn")
+		fmt.Println("  permission <session_id> <allow|deny>  Answer a pending permission prompt")
+		fmt.Println("  enqueue <session_id> <text|->  Queue a prompt for when the session stops")
+		fmt.Println("  queue <session_id> [clear]  Show or clear queued prompts")
 		fmt.Println("  delete <session_id>  Delete a session")
 		fmt.Println("  info <session_id>    Get session information")
 		fmt.Println("  status <session_id>  Get session status")
+		fmt.Println("  wait <session_id> [timeout]  Wait until the session stops or needs permission")
+		fmt.Println("  budget <session_id> <tokens>  Set token budget (0 = unlimited)")
+		fmt.Println("  log <session_id> [limit] [-f] [--thinking] [--tree]  Show conversation messages")
+		fmt.Println("  events [session_id]  Stream message and status events")
+		fmt.Println("  export <session_id> [--format markdown|html] [-o file]  Export the transcript")
+		fmt.Println("  search [query] [--regex] [--tool name] [--path file] [--all]  Search transcripts")
+		fmt.Println("  changes <session_id> [--diff] [path]  List files changed by the agent")
+		fmt.Println("  todos <session_id>   Show Claude's todo list")
+		fmt.Println("  result <session_id> [--json] [--schema file]  Show the final answer of the last turn")
+		fmt.Println("  version              Show client and server API versions")
+		fmt.Println("  audit [session_id] [--since 1h] [--limit n]  Show the audit log (admin)")
+		fmt.Println("  quotas               Show session quotas and usage per caller (admin)")
+		fmt.Println("  mcp                  Serve the session tools over MCP (stdio)")
 		os.Exit(1)
 	}
 
-	client := &unixClient{socketPath: *socketPath}
+	c, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	c.Raw = *raw
 
 	cmd := args[0]
 	switch cmd {
 	case "create":
-		cmdCreate(client, args[1:])
+		cmdCreate(c, args[1:])
 	case "list":
-		cmdList(client)
+		cmdList(c)
 	case "connect":
 		if len(args) < 2 {
 			fmt.Fprintln(os.Stderr, "Usage: claude-pty connect <session_id>")
 			os.Exit(1)
 		}
-		cmdConnect(client, args[1])
+		cmdConnect(c, args[1])
 	case "get":
 		if len(args) < 2 {
 			fmt.Fprintln(os.Stderr, "Usage: claude-pty get <session_id> [limit]")
@@ -413,33 +874,93 @@ func main() {
 		if len(args) >= 3 {
 			limitStr = args[2]
 		}
-		cmdGet(client, args[1], limitStr)
+		cmdGet(c, args[1], limitStr)
 	case "input":
 		if len(args) < 3 {
 			fmt.Fprintln(os.Stderr, "Usage: claude-pty input <session_id> <text>")
 			os.Exit(1)
 		}
-		cmdInput(client, args[1], args[2])
+		cmdInput(c, args[1], args[2])
+	case "key":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: claude-pty key <session_id> <key>...")
+			os.Exit(1)
+		}
+		cmdKey(c, args[1], args[2:])
+	case "submit":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: claude-pty submit <session_id> <text|->")
+			os.Exit(1)
+		}
+		cmdSubmit(c, args[1], args[2])
+	case "interrupt":
+		cmdInterrupt(c, args[1:])
+	case "permission":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: claude-pty permission <session_id> <allow|deny>")
+			os.Exit(1)
+		}
+		cmdPermission(c, args[1], args[2])
+	case "enqueue":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: claude-pty enqueue <session_id> <text|->")
+			os.Exit(1)
+		}
+		cmdEnqueue(c, args[1], args[2])
+	case "queue":
+		cmdQueue(c, args[1:])
 	case "delete":
 		if len(args) < 2 {
 			fmt.Fprintln(os.Stderr, "Usage: claude-pty delete <session_id>")
 			os.Exit(1)
 		}
-		cmdDelete(client, args[1])
+		cmdDelete(c, args[1])
 	case "info":
 		if len(args) < 2 {
 			fmt.Fprintln(os.Stderr, "Usage: claude-pty info <session_id>")
 			os.Exit(1)
 		}
-		cmdInfo(client, args[1])
+		cmdInfo(c, args[1])
 	case "log":
-		cmdLog(client, args[1:])
+		cmdLog(c, args[1:])
+	case "events":
+		cmdEvents(c, args[1:])
+	case "export":
+		cmdExport(c, args[1:])
+	case "search":
+		cmdSearch(c, args[1:])
+	case "changes":
+		cmdChanges(c, args[1:])
+	case "todos":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: claude-pty todos <session_id>")
+			os.Exit(1)
+		}
+		cmdTodos(c, args[1])
+	case "result":
+		cmdResult(c, args[1:])
+	case "version":
+		cmdVersion(c)
+	case "budget":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: claude-pty budget <session_id> <tokens>")
+			os.Exit(1)
+		}
+		cmdBudget(c, args[1], args[2])
 	case "status":
 		if len(args) < 2 {
 			fmt.Fprintln(os.Stderr, "Usage: claude-pty status <session_id>")
 			os.Exit(1)
 		}
-		cmdStatus(client, args[1])
+		cmdStatus(c, args[1])
+	case "wait":
+		cmdWait(c, args[1:])
+	case "audit":
+		cmdAudit(c, args[1:])
+	case "quotas":
+		cmdQuotas(c)
+	case "mcp":
+		cmdMCP(c)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
 		os.Exit(1)
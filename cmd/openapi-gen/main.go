@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"claude-pty/internal"
+)
+
+// openapi-gen 生成 OpenAPI 文档；-check 时只比较已提交的文件，不一致则以非零状态退出
+func main() {
+	output := flag.String("o", "api/openapi.json", "Output file")
+	check := flag.Bool("check", false, "Fail if the output file is out of date instead of writing it")
+	flag.Parse()
+
+	data, err := internal.MarshalOpenAPI()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *check {
+		existing, err := os.ReadFile(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !bytes.Equal(existing, data) {
+			fmt.Fprintf(os.Stderr, "%s is out of date; run: go run ./cmd/openapi-gen\n", *output)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is up to date\n", *output)
+		return
+	}
+
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s\n", *output)
+}
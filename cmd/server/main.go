@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,6 +14,24 @@ import (
 
 func main() {
 	socketPath := flag.String("socket", internal.GetDefaultSocketPath(), "Unix socket path")
+	policyPath := flag.String("policy", os.Getenv("CLAUDE_PTY_POLICY"), "Permission policy file (JSON)")
+	pricingPath := flag.String("pricing", os.Getenv("CLAUDE_PTY_PRICING"), "Model pricing file (JSON, USD per million tokens)")
+	listenAddr := flag.String("listen", os.Getenv("CLAUDE_PTY_LISTEN"), "Also listen on TCP (e.g. :7681, loopback unless a host is given); requires -tokens")
+	tokensPath := flag.String("tokens", os.Getenv("CLAUDE_PTY_TOKENS"), "Bearer tokens for the TCP listener (JSON)")
+	tlsCert := flag.String("tls-cert", os.Getenv("CLAUDE_PTY_TLS_CERT"), "TLS certificate for the TCP listener")
+	tlsKey := flag.String("tls-key", os.Getenv("CLAUDE_PTY_TLS_KEY"), "TLS private key for the TCP listener")
+	allowUIDs := flag.String("allow-uids", os.Getenv("CLAUDE_PTY_ALLOW_UIDS"), "Comma-separated UIDs allowed on the Unix socket besides the server's own")
+	allowGIDs := flag.String("allow-gids", os.Getenv("CLAUDE_PTY_ALLOW_GIDS"), "Comma-separated GIDs allowed on the Unix socket (primary or supplementary group)")
+	adminUIDs := flag.String("admin-uids", os.Getenv("CLAUDE_PTY_ADMIN_UIDS"), "Comma-separated UIDs that may control every session (the server's own UID always can)")
+	auditPath := flag.String("audit-log", envOr("CLAUDE_PTY_AUDIT_LOG", internal.DefaultAuditLogPath()), "Audit log (JSONL) of state-changing calls; \"off\" disables it")
+	auditMaxSize := flag.Int64("audit-max-size", internal.DefaultAuditMaxSize>>20, "Rotate the audit log after this many MB")
+	auditMaxFiles := flag.Int("audit-max-files", internal.DefaultAuditMaxFiles, "Rotated audit log files to keep")
+	var limits internal.Limits
+	flag.IntVar(&limits.MaxSessions, "max-sessions", 0, "Maximum concurrent sessions (0 = unlimited)")
+	flag.IntVar(&limits.MaxSessionsPerCaller, "max-sessions-per-caller", 0, "Maximum concurrent sessions per UID or token (0 = unlimited)")
+	flag.IntVar(&limits.CreatesPerMinute, "creates-per-minute", 0, "Maximum sessions a UID or token may create per minute (0 = unlimited)")
+	flag.IntVar(&limits.MaxInputBytes, "max-input-size", 0, "Maximum bytes per input, submit or enqueue (0 = unlimited)")
+	redactPath := flag.String("redact", os.Getenv("CLAUDE_PTY_REDACT"), "Secret redaction rules (JSON); built-in detectors are used when empty, \"off\" disables redaction")
 	flag.Parse()
 
 	logger := log.New(os.Stdout, "[claude-pty-server] ", log.LstdFlags)
@@ -19,6 +39,82 @@ func main() {
 
 	server := internal.NewServer(*socketPath)
 
+	if *policyPath != "" {
+		policy, err := internal.LoadPolicy(*policyPath)
+		if err != nil {
+			logger.Fatalf("Load policy: %v", err)
+		}
+		server.SetPolicy(policy)
+		logger.Printf("Loaded %d policy rules from %s", len(policy.Rules), *policyPath)
+	}
+
+	if *pricingPath != "" {
+		pricing, err := internal.LoadPricing(*pricingPath)
+		if err != nil {
+			logger.Fatalf("Load pricing: %v", err)
+		}
+		server.SetPricing(pricing)
+	}
+
+	var access internal.PeerAccess
+	for _, list := range []struct {
+		name  string
+		value string
+		ids   *[]int
+	}{
+		{"allow-uids", *allowUIDs, &access.UIDs},
+		{"allow-gids", *allowGIDs, &access.GIDs},
+		{"admin-uids", *adminUIDs, &access.AdminUIDs},
+	} {
+		ids, err := internal.ParseIDList(list.value)
+		if err != nil {
+			logger.Fatalf("Parse -%s: %v", list.name, err)
+		}
+		*list.ids = ids
+	}
+	server.SetPeerAccess(access)
+	server.SetLimits(limits)
+
+	if *auditPath != "" && *auditPath != "off" {
+		audit, err := internal.OpenAuditLog(*auditPath, *auditMaxSize<<20, *auditMaxFiles)
+		if err != nil {
+			logger.Fatalf("Open audit log: %v", err)
+		}
+		server.SetAuditLog(audit)
+		logger.Printf("Audit log: %s", audit.Path())
+	}
+
+	switch *redactPath {
+	case "":
+	case "off":
+		server.SetRedactor(nil)
+		logger.Printf("Secret redaction disabled")
+	default:
+		redactor, err := internal.LoadRedactor(*redactPath)
+		if err != nil {
+			logger.Fatalf("Load redaction rules: %v", err)
+		}
+		server.SetRedactor(redactor)
+		logger.Printf("Loaded %d redaction rules from %s", redactor.Rules(), *redactPath)
+	}
+
+	if *tokensPath != "" {
+		tokens, err := internal.LoadTokens(*tokensPath)
+		if err != nil {
+			logger.Fatalf("Load tokens: %v", err)
+		}
+		server.SetTokens(tokens)
+		logger.Printf("Loaded %d tokens from %s", len(tokens), *tokensPath)
+	}
+
+	if *listenAddr != "" {
+		go func() {
+			if err := server.StartTCP(*listenAddr, *tlsCert, *tlsKey); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatalf("TCP listener error: %v", err)
+			}
+		}()
+	}
+
 	// 等待信号以优雅关闭
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -34,3 +130,11 @@ func main() {
 		logger.Fatalf("Server error: %v", err)
 	}
 }
+
+// envOr 返回环境变量的值，未设置时返回 fallback
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
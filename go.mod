@@ -5,9 +5,6 @@ go 1.24.0
 require (
 	github.com/creack/pty v1.1.24
 	github.com/google/uuid v1.6.0
-)
-
-require (
-	golang.org/x/sys v0.41.0 // indirect
-	golang.org/x/term v0.40.0 // indirect
+	golang.org/x/sys v0.41.0
+	golang.org/x/term v0.40.0
 )
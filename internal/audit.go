@@ -0,0 +1,314 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 审计日志默认的轮转参数
+const (
+	DefaultAuditMaxSize  = 10 << 20 // 单个文件最大字节数
+	DefaultAuditMaxFiles = 5        // 保留的轮转文件数（audit.jsonl.1 ... .N）
+)
+
+// defaultAuditLimit audit 查询默认返回的条数
+const defaultAuditLimit = 100
+
+// ErrAuditDisabled server 没有启用审计日志
+var ErrAuditDisabled = errors.New("audit log not enabled")
+
+// AuditLog 只追加的 JSONL 审计日志，超过 maxSize 时轮转为 path.1 ... path.maxFiles
+type AuditLog struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// DefaultAuditLogPath 默认的审计日志路径：$XDG_STATE_HOME/claude-pty/audit.jsonl（默认 ~/.local/state）
+func DefaultAuditLogPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "claude-pty", "audit.jsonl")
+}
+
+// OpenAuditLog 打开（或创建）审计日志。maxSize、maxFiles 为 0 时使用默认值
+func OpenAuditLog(path string, maxSize int64, maxFiles int) (*AuditLog, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultAuditMaxSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultAuditMaxFiles
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("create audit log directory: %w", err)
+	}
+
+	a := &AuditLog{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Path 返回审计日志路径
+func (a *AuditLog) Path() string {
+	return a.path
+}
+
+// open 以追加方式打开当前文件，调用方需持有 a.mu（或尚未共享 a）
+func (a *AuditLog) open() error {
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat audit log: %w", err)
+	}
+	a.file, a.size = file, info.Size()
+	return nil
+}
+
+// Write 追加一条记录
+func (a *AuditLog) Write(entry *AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.size > 0 && a.size+int64(len(data)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(data)
+	a.size += int64(n)
+	return err
+}
+
+// rotate 关闭当前文件并依次重命名：path.N-1 -> path.N，...，path -> path.1，超出 maxFiles 的文件被删除。
+// 调用方需持有 a.mu
+func (a *AuditLog) rotate() error {
+	a.file.Close()
+	os.Remove(a.rotatedPath(a.maxFiles))
+	for i := a.maxFiles - 1; i >= 1; i-- {
+		os.Rename(a.rotatedPath(i), a.rotatedPath(i+1))
+	}
+	if err := os.Rename(a.path, a.rotatedPath(1)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotate audit log: %w", err)
+	}
+	return a.open()
+}
+
+// rotatedPath 第 i 个轮转文件的路径
+func (a *AuditLog) rotatedPath(i int) string {
+	return a.path + "." + strconv.Itoa(i)
+}
+
+// Close 关闭审计日志
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// Query 按时间顺序读取所有文件（包括轮转文件）中满足条件的记录，返回最后 limit 条。
+// sessionID 为空时不过滤会话，since 为零值时不过滤时间
+func (a *AuditLog) Query(sessionID string, since time.Time, limit int) ([]*AuditEntry, error) {
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+
+	readers, err := a.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, r := range readers {
+			r.file.Close()
+		}
+	}()
+
+	var entries []*AuditEntry
+	for _, r := range readers {
+		scanner := bufio.NewScanner(io.LimitReader(r.file, r.size))
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+				continue
+			}
+			if sessionID != "" && entry.SessionID != sessionID {
+				continue
+			}
+			if !since.IsZero() {
+				if t, err := time.Parse(time.RFC3339Nano, entry.Time); err != nil || t.Before(since) {
+					continue
+				}
+			}
+			entries = append(entries, &entry)
+			if len(entries) > limit {
+				entries = entries[1:]
+			}
+		}
+	}
+	return entries, nil
+}
+
+// auditReader 查询时打开的审计文件及需要读取的字节数
+type auditReader struct {
+	file *os.File
+	size int64
+}
+
+// snapshot 在 a.mu 下按从旧到新的顺序打开所有审计文件，读取和解码在锁外进行。
+// 已打开的文件不受之后轮转时重命名的影响；当前文件只读取到快照时的大小，避免读到写了一半的记录
+func (a *AuditLog) snapshot() ([]auditReader, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var readers []auditReader
+	fail := func(err error) ([]auditReader, error) {
+		for _, r := range readers {
+			r.file.Close()
+		}
+		return nil, err
+	}
+	for i := a.maxFiles; i >= 0; i-- {
+		path := a.path
+		if i > 0 {
+			path = a.rotatedPath(i)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fail(fmt.Errorf("read audit log: %w", err))
+		}
+		size := a.size
+		if i > 0 {
+			info, err := file.Stat()
+			if err != nil {
+				file.Close()
+				return fail(fmt.Errorf("stat audit log: %w", err))
+			}
+			size = info.Size()
+		}
+		readers = append(readers, auditReader{file: file, size: size})
+	}
+	return readers, nil
+}
+
+// SetAuditLog 设置审计日志，nil 表示不记录
+func (s *Server) SetAuditLog(audit *AuditLog) {
+	s.audit = audit
+}
+
+// recordAudit 记录一次修改状态的 API 调用。请求内容（prompt 等）不写入日志，只记录其 SHA-256
+func (s *Server) recordAudit(req Request, resp Response) {
+	if s.audit == nil {
+		return
+	}
+
+	entry := &AuditEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Action:    req.Action,
+		SessionID: req.SessionID,
+		Success:   resp.Success,
+	}
+	if req.caller != nil {
+		entry.Caller = req.caller.Name
+		entry.Scope = req.caller.Scope
+		if req.caller.UID >= 0 {
+			uid := req.caller.UID
+			entry.UID = &uid
+		}
+	}
+	if entry.SessionID == "" && resp.Session != nil {
+		entry.SessionID = resp.Session.ID // create
+	}
+	if !resp.Success {
+		entry.Code = errorCode(resp)
+	}
+	if payload, err := json.Marshal(req); err == nil {
+		entry.PayloadHash = payloadHash(payload)
+	}
+
+	if err := s.audit.Write(entry); err != nil {
+		s.logger.Printf("write audit log: %v", err)
+	}
+}
+
+// recordPolicyAudit 记录自动授权规则做出的权限决策
+func (s *Server) recordPolicyAudit(sessionID string, rule *PolicyRule, event *HookEvent, hook []byte) {
+	if s.audit == nil {
+		return
+	}
+
+	entry := &AuditEntry{
+		Time:        time.Now().UTC().Format(time.RFC3339Nano),
+		Caller:      "policy",
+		Action:      "policy_" + rule.Decision,
+		SessionID:   sessionID,
+		Tool:        event.ToolName,
+		PayloadHash: payloadHash(hook),
+		Success:     true,
+	}
+	if err := s.audit.Write(entry); err != nil {
+		s.logger.Printf("write audit log: %v", err)
+	}
+}
+
+// payloadHash 返回内容的 SHA-256（sha256:<hex>）
+func payloadHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// handleAudit 查询审计日志
+func (s *Server) handleAudit(req Request) Response {
+	if s.audit == nil {
+		return errorResponse(ErrAuditDisabled)
+	}
+
+	var since time.Time
+	if req.Since != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, req.Since)
+		if err != nil {
+			return Response{Success: false, Error: "invalid since (RFC 3339 expected): " + req.Since}
+		}
+	}
+
+	entries, err := s.audit.Query(req.SessionID, since, req.Limit)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return Response{Success: true, Audit: entries}
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Scope token 的权限范围，高级别包含低级别：admin > input > read
+type Scope string
+
+// 权限范围定义
+const (
+	ScopeRead  Scope = "read"  // 只读：状态、输出、消息、搜索、事件
+	ScopeInput Scope = "input" // 驱动会话：创建、输入、提交、中断、队列
+	ScopeAdmin Scope = "admin" // 管理：删除会话、设置状态/规则/预算、hook 接口
+)
+
+// scopeLevels 权限范围的级别
+var scopeLevels = map[Scope]int{ScopeRead: 1, ScopeInput: 2, ScopeAdmin: 3}
+
+// allows 判断 s 是否包含 required
+func (s Scope) allows(required Scope) bool {
+	return scopeLevels[s] >= scopeLevels[required]
+}
+
+// minTokenLength token 的最短长度，避免使用容易猜测的 token
+const minTokenLength = 16
+
+// Token TCP 接口的访问令牌
+type Token struct {
+	Name  string `json:"name"`  // 调用方名称（用于日志）
+	Token string `json:"token"` // Authorization: Bearer <token>
+	Scope Scope  `json:"scope"`
+}
+
+// TokenConfig token 配置文件
+type TokenConfig struct {
+	Tokens []*Token `json:"tokens"`
+}
+
+// LoadTokens 从 JSON 文件加载 token
+func LoadTokens(path string) ([]*Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tokens: %w", err)
+	}
+
+	var config TokenConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse tokens: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, t := range config.Tokens {
+		if _, ok := scopeLevels[t.Scope]; !ok {
+			return nil, fmt.Errorf("token %d: invalid scope %q (read, input or admin)", i, t.Scope)
+		}
+		if len(t.Token) < minTokenLength {
+			return nil, fmt.Errorf("token %d: token must be at least %d characters", i, minTokenLength)
+		}
+		if seen[t.Token] {
+			return nil, fmt.Errorf("token %d: duplicate token", i)
+		}
+		seen[t.Token] = true
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("token-%d", i)
+		}
+	}
+	return config.Tokens, nil
+}
+
+// Caller 发起请求的调用方
+type Caller struct {
+	Name  string
+	Scope Scope
+	UID   int // Unix socket 对端的 UID，TCP token 为 -1
+}
+
+// localCaller 没有连接信息的本地调用方（如在进程内直接调用 ServeHTTP），拥有全部权限
+var localCaller = &Caller{Name: "local", Scope: ScopeAdmin, UID: os.Getuid()}
+
+type (
+	callerKey  struct{} // 请求 context 中的 *Caller
+	tcpConnKey struct{} // 连接来自 TCP listener
+)
+
+// callerFrom 返回请求的调用方，没有认证信息时为 nil
+func callerFrom(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerKey{}).(*Caller)
+	return caller
+}
+
+// allows 判断调用方是否拥有 required 权限；nil 为 server 内部调用
+func (c *Caller) allows(required Scope) bool {
+	return c == nil || c.Scope.allows(required)
+}
+
+// authenticate 识别调用方：Unix socket 连接按对端 UID/GID 判断（见 PeerAccess），TCP 连接需要 Bearer token
+func (s *Server) authenticate(r *http.Request) (*Caller, error) {
+	if r.Context().Value(tcpConnKey{}) == nil {
+		if r.RemoteAddr != "@" && r.RemoteAddr != "" {
+			return nil, fmt.Errorf("%w: non-local connection from %s", ErrForbidden, r.RemoteAddr)
+		}
+		cred, ok := r.Context().Value(peerCredKey{}).(*peerCred)
+		if !ok {
+			return localCaller, nil
+		}
+		if cred == nil {
+			return nil, fmt.Errorf("%w: cannot read peer credentials", ErrForbidden)
+		}
+		return s.peerCaller(cred)
+	}
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, fmt.Errorf("%w: bearer token required", ErrUnauthorized)
+	}
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return &Caller{Name: t.Name, Scope: t.Scope, UID: -1}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid token", ErrUnauthorized)
+}
+
+// authorize 检查调用方能否执行需要 required 权限的操作。TCP token 只按 scope 判断；
+// 本地用户（Unix socket）修改会话时必须是管理员或会话创建者，创建者对自己的会话拥有全部权限
+func (s *Server) authorize(caller *Caller, what string, required Scope, sessionID string) error {
+	if caller == nil || caller.Scope == ScopeAdmin {
+		return nil
+	}
+	if required == ScopeRead || sessionID == "" || caller.UID < 0 {
+		if !caller.allows(required) {
+			return fmt.Errorf("%w: %s requires %s scope (%q has %s)", ErrForbidden, what, required, caller.Name, caller.Scope)
+		}
+		return nil
+	}
+
+	session, err := s.sessionMgr.GetSession(sessionID)
+	if err != nil {
+		return nil // 由处理函数返回会话不存在
+	}
+	if owner := session.ownerUID(); owner != caller.UID {
+		return fmt.Errorf("%w: session %s is owned by uid %d", ErrForbidden, sessionID, owner)
+	}
+	return nil
+}
+
+// SetTokens 设置 TCP 接口接受的 token
+func (s *Server) SetTokens(tokens []*Token) {
+	s.tokens = tokens
+}
+
+// StartTCP 在 TCP 地址上提供与 Unix socket 相同的 API，所有请求都需要 Bearer token。
+// addr 没有主机部分时只监听 127.0.0.1；certFile 和 keyFile 都指定时启用 TLS。阻塞直到 Stop。
+func (s *Server) StartTCP(addr, certFile, keyFile string) error {
+	if len(s.tokens) == 0 {
+		return errors.New("TCP listener requires at least one token")
+	}
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("TLS requires both a certificate and a key")
+	}
+
+	addr = loopbackDefault(addr)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", addr, err)
+	}
+
+	s.tcpServer = &http.Server{
+		Handler: s,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, tcpConnKey{}, true)
+		},
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("load TLS certificate: %w", err)
+		}
+		s.tcpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		s.logger.Printf("Server listening on https://%s", listener.Addr())
+		return s.tcpServer.ServeTLS(listener, "", "")
+	}
+
+	if host, _, _ := net.SplitHostPort(addr); !isLoopback(host) {
+		s.logger.Printf("warning: TCP listener on %s without TLS; tokens are sent in clear text", addr)
+	}
+	s.logger.Printf("Server listening on http://%s", listener.Addr())
+	return s.tcpServer.Serve(listener)
+}
+
+// loopbackDefault 为没有主机部分的地址（如 ":7681" 或 "7681"）补上 127.0.0.1
+func loopbackDefault(addr string) string {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	if strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + addr
+	}
+	return addr
+}
+
+// isLoopback 判断主机是否为本机回环地址
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,31 @@
+package internal
+
+import "testing"
+
+func TestSearchAllProjectsRequiresAdmin(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := NewServer(t.TempDir() + "/test.sock")
+
+	tests := []struct {
+		name        string
+		caller      *Caller
+		allProjects bool
+		forbidden   bool
+	}{
+		{"read token 搜索受管理会话", &Caller{Name: "reader", Scope: ScopeRead, UID: -1}, false, false},
+		{"read token 搜索所有项目", &Caller{Name: "reader", Scope: ScopeRead, UID: -1}, true, true},
+		{"input token 搜索所有项目", &Caller{Name: "driver", Scope: ScopeInput, UID: -1}, true, true},
+		{"非管理员 UID 搜索所有项目", &Caller{Name: "uid:1000", Scope: ScopeInput, UID: 1000}, true, true},
+		{"admin token 搜索所有项目", &Caller{Name: "admin", Scope: ScopeAdmin, UID: -1}, true, false},
+		{"本地调用搜索所有项目", nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.dispatch(Request{Action: "search", Query: "x", AllProjects: tt.allProjects, caller: tt.caller})
+			forbidden := !resp.Success && errorCode(resp) == CodeForbidden
+			if forbidden != tt.forbidden {
+				t.Errorf("forbidden = %v，期望 %v（响应: %+v）", forbidden, tt.forbidden, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 文件改动类型
+const (
+	ChangeCreated = "created"
+	ChangeEdited  = "edited"
+	ChangeDeleted = "deleted"
+)
+
+// fileOp 一次成功的文件修改
+type fileOp struct {
+	tool    string
+	content string     // Write 写入的内容
+	edits   []stringOp // Edit/MultiEdit 的替换
+}
+
+// stringOp 一次字符串替换
+type stringOp struct {
+	OldString  string `json:"old_string"`
+	NewString  string `json:"new_string"`
+	ReplaceAll bool   `json:"replace_all"`
+}
+
+// fileRecord 一个文件在会话中的改动
+type fileRecord struct {
+	path     string
+	created  bool
+	deleted  bool
+	edits    int
+	ops      []*fileOp
+	original *string // 第一次修改前的内容（来自 toolUseResult 或 file-history 备份），未知时为 nil
+	last     string  // 最后一次改动的时间
+}
+
+// pendingOp 等待 tool_result 的文件操作
+type pendingOp struct {
+	tool  string
+	input json.RawMessage
+	cwd   string
+}
+
+// shellSeparatorRe 匹配 shell 命令分隔符，deletedPaths 用它把命令拆成简单命令
+var shellSeparatorRe = regexp.MustCompile(`&&|\|\||[;|\n]`)
+
+// GetChanges 汇总会话中 agent 新建、修改、删除的文件（按路径排序）。
+// 只统计执行成功的 Write/Edit/MultiEdit/NotebookEdit 调用；删除只是尽力识别 Bash 中简单的 rm / git rm（见 deletedPaths）。
+// withDiff 为 true 时为每个文件生成 agent 改动的 unified diff；path 非空时只返回该文件。
+func (sm *SessionManager) GetChanges(sessionID string, withDiff bool, path string) ([]*FileChange, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	jsonlPath, err := sm.transcriptPath(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(jsonlPath)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	records := make(map[string]*fileRecord)
+	backups := make(map[string]*fileBackup) // 每个文件最早的备份
+	pending := make(map[string]*pendingOp)
+	record := func(p string) *fileRecord {
+		r, ok := records[p]
+		if !ok {
+			r = &fileRecord{path: p}
+			records[p] = r
+		}
+		return r
+	}
+
+	_, err = scanTranscript(file, 0, func(entry *transcriptEntry, end int64) {
+		for p, backup := range entry.Backups {
+			if prev, ok := backups[p]; !ok || backup.Version < prev.Version {
+				backups[p] = backup
+			}
+		}
+
+		for _, msg := range entry.Messages {
+			if msg.Type != "tool" || msg.ToolUseID == "" {
+				continue
+			}
+			switch msg.ToolName {
+			case "Write", "Edit", "MultiEdit", "NotebookEdit", "Bash":
+				pending[msg.ToolUseID] = &pendingOp{tool: msg.ToolName, input: msg.Input, cwd: entry.CWD}
+			}
+		}
+
+		for _, result := range entry.Results {
+			op, ok := pending[result.ToolUseID]
+			if !ok {
+				continue
+			}
+			delete(pending, result.ToolUseID)
+			if result.Result.IsError {
+				continue
+			}
+
+			// 一行中只有一个 tool_result 时 toolUseResult 才能确定属于哪个调用
+			var toolResult json.RawMessage
+			if len(entry.Results) == 1 {
+				toolResult = entry.ToolResult
+			}
+
+			if op.tool == "Bash" {
+				var input struct {
+					Command string `json:"command"`
+				}
+				json.Unmarshal(op.input, &input)
+				cwd := op.cwd
+				if cwd == "" {
+					cwd = session.CWD
+				}
+				for _, p := range deletedPaths(input.Command, cwd) {
+					r := record(p)
+					r.deleted = true
+					r.last = entry.Timestamp
+				}
+				continue
+			}
+
+			p := toolInputPath(op.input)
+			if p == "" {
+				continue
+			}
+			r := record(p)
+			r.deleted = false
+			r.edits++
+			r.last = entry.Timestamp
+			r.apply(op, toolResult)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claudeID := claudeIDOf(session)
+	var changes []*FileChange
+	for p, r := range records {
+		if path != "" && !sameFile(p, path, session.CWD) {
+			continue
+		}
+		if r.original == nil {
+			if backup, ok := backups[p]; ok {
+				r.original = readBackup(claudeID, backup)
+			}
+		}
+		if r.original != nil && *r.original == "" && len(r.ops) > 0 && r.ops[0].tool == "Write" {
+			r.created = true
+		}
+
+		change := &FileChange{Path: p, Edits: r.edits, LastModified: r.last}
+		switch {
+		case r.deleted:
+			change.Action = ChangeDeleted
+		case r.created:
+			change.Action = ChangeCreated
+		default:
+			change.Action = ChangeEdited
+		}
+		if withDiff {
+			change.Diff, change.DiffError = r.diff(displayPath(p, session.CWD))
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// apply 记录一次文件修改；toolResult 中的 originalFile 是修改前的完整内容
+func (r *fileRecord) apply(op *pendingOp, toolResult json.RawMessage) {
+	var result struct {
+		Type         string  `json:"type"`
+		OriginalFile *string `json:"originalFile"`
+	}
+	if len(toolResult) > 0 {
+		json.Unmarshal(toolResult, &result)
+	}
+	if len(r.ops) == 0 && r.original == nil {
+		if result.Type == "create" {
+			empty := ""
+			r.original = &empty
+			r.created = true
+		} else if result.OriginalFile != nil {
+			r.original = result.OriginalFile
+		}
+	}
+
+	var input struct {
+		Content   string     `json:"content"`
+		OldString string     `json:"old_string"`
+		NewString string     `json:"new_string"`
+		Replace   bool       `json:"replace_all"`
+		Edits     []stringOp `json:"edits"`
+	}
+	json.Unmarshal(op.input, &input)
+
+	switch op.tool {
+	case "Write":
+		r.ops = append(r.ops, &fileOp{tool: op.tool, content: input.Content})
+	case "Edit":
+		r.ops = append(r.ops, &fileOp{tool: op.tool, edits: []stringOp{{input.OldString, input.NewString, input.Replace}}})
+	case "MultiEdit":
+		r.ops = append(r.ops, &fileOp{tool: op.tool, edits: input.Edits})
+	default:
+		// NotebookEdit 修改的是 JSON 中的单元格，无法按文本重放
+		r.ops = append(r.ops, &fileOp{tool: op.tool})
+	}
+}
+
+// diff 生成 agent 改动的 unified diff。
+// 修改前的内容优先使用 toolUseResult / file-history 备份；都没有时从磁盘上的当前内容反向回放得到。
+func (r *fileRecord) diff(name string) (string, string) {
+	before := r.original
+	if before == nil {
+		current, err := os.ReadFile(r.path)
+		if err != nil {
+			return "", "original content unavailable"
+		}
+		original, ok := r.revert(string(current))
+		if !ok {
+			return "", "original content unavailable"
+		}
+		before = &original
+	}
+
+	after, ok := r.replay(*before)
+	if !ok {
+		return "", "cannot replay edits"
+	}
+
+	oldName, newName := name, name
+	if r.created {
+		oldName = ""
+	}
+	if r.deleted {
+		after = ""
+		newName = ""
+	}
+	return unifiedDiff(oldName, newName, *before, after), ""
+}
+
+// replay 在 content 上依次重放所有修改
+func (r *fileRecord) replay(content string) (string, bool) {
+	for _, op := range r.ops {
+		switch {
+		case op.tool == "Write":
+			content = op.content
+		case op.edits != nil:
+			for _, edit := range op.edits {
+				if !strings.Contains(content, edit.OldString) {
+					return "", false
+				}
+				if edit.ReplaceAll {
+					content = strings.ReplaceAll(content, edit.OldString, edit.NewString)
+				} else {
+					content = strings.Replace(content, edit.OldString, edit.NewString, 1)
+				}
+			}
+		default:
+			return "", false
+		}
+	}
+	return content, true
+}
+
+// revert 从修改后的内容反向回放，得到第一次修改前的内容（Write 无法反向回放）
+func (r *fileRecord) revert(content string) (string, bool) {
+	for i := len(r.ops) - 1; i >= 0; i-- {
+		op := r.ops[i]
+		if op.edits == nil {
+			return "", false
+		}
+		for j := len(op.edits) - 1; j >= 0; j-- {
+			edit := op.edits[j]
+			if !strings.Contains(content, edit.NewString) {
+				return "", false
+			}
+			if edit.ReplaceAll {
+				content = strings.ReplaceAll(content, edit.NewString, edit.OldString)
+			} else {
+				content = strings.Replace(content, edit.NewString, edit.OldString, 1)
+			}
+		}
+	}
+	return content, true
+}
+
+// readBackup 读取 ~/.claude/file-history 中的文件备份；备份时文件不存在则返回空内容
+func readBackup(claudeSessionID string, backup *fileBackup) *string {
+	content := ""
+	if backup.BackupFileName == nil {
+		return &content
+	}
+	data, err := os.ReadFile(filepath.Join(os.Getenv("HOME"), ".claude", "file-history", claudeSessionID, *backup.BackupFileName))
+	if err != nil {
+		return nil
+	}
+	content = string(data)
+	return &content
+}
+
+// deletedPaths 尽力从 shell 命令中识别 rm / git rm（可带 sudo）删除的文件，不展开通配符和变量。
+// find -delete、xargs rm、子 shell、脚本或其他程序中的删除都无法识别，不会出现在结果中
+func deletedPaths(command, cwd string) []string {
+	var paths []string
+	for _, segment := range shellSeparatorRe.Split(command, -1) {
+		fields := strings.Fields(segment)
+		if len(fields) > 0 && fields[0] == "sudo" {
+			fields = fields[1:]
+		}
+		switch {
+		case len(fields) > 1 && fields[0] == "rm":
+			fields = fields[1:]
+		case len(fields) > 2 && fields[0] == "git" && fields[1] == "rm":
+			fields = fields[2:]
+		default:
+			continue
+		}
+
+		options := true
+		for _, arg := range fields {
+			arg = strings.Trim(arg, `"'`)
+			if options && arg == "--" {
+				options = false // 之后的参数都是路径，即使以 - 开头
+				continue
+			}
+			if arg == "" || (options && strings.HasPrefix(arg, "-")) || strings.ContainsAny(arg, "*?[$`") {
+				continue
+			}
+			if !filepath.IsAbs(arg) {
+				arg = filepath.Join(cwd, arg)
+			}
+			paths = append(paths, filepath.Clean(arg))
+		}
+	}
+	return paths
+}
+
+// displayPath 返回相对 cwd 的路径（不在 cwd 内时返回绝对路径去掉开头的 /）
+func displayPath(p, cwd string) string {
+	if rel, ok := relativeToCWD(p, cwd); ok {
+		return rel
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// sameFile 判断 p 是否就是请求中的 want（want 可以是相对 cwd 的路径）
+func sameFile(p, want, cwd string) bool {
+	if !filepath.IsAbs(want) {
+		want = filepath.Join(cwd, want)
+	}
+	return filepath.Clean(p) == filepath.Clean(want)
+}
@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeletedPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+	}{
+		{"rm", "rm a.txt", []string{"/work/a.txt"}},
+		{"选项与绝对路径", "rm -rf build /tmp/x", []string{"/work/build", "/tmp/x"}},
+		{"-- 之后的参数都是路径", "rm -f -- -weird.txt", []string{"/work/-weird.txt"}},
+		{"git rm 与 sudo", "git rm old.go && sudo rm /etc/x", []string{"/work/old.go", "/etc/x"}},
+		{"通配符不展开", "rm *.log", nil},
+		{"find -delete 无法识别", "find . -name '*.tmp' -delete", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deletedPaths(tt.command, "/work"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deletedPaths = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext unified diff 中变更前后保留的上下文行数
+const diffContext = 3
+
+// diffOp 行级编辑操作：' ' 相同，'-' 删除，'+' 新增
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff 生成 before 到 after 的 unified diff；oldName 或 newName 为空时使用 /dev/null（新建或删除文件）。
+// 内容相同时返回空字符串。
+func unifiedDiff(oldName, newName, before, after string) string {
+	if before == after {
+		return ""
+	}
+
+	ops := diffLines(splitLines(before), splitLines(after))
+
+	var b strings.Builder
+	if oldName == "" {
+		b.WriteString("--- /dev/null\n")
+	} else {
+		fmt.Fprintf(&b, "--- a/%s\n", oldName)
+	}
+	if newName == "" {
+		b.WriteString("+++ /dev/null\n")
+	} else {
+		fmt.Fprintf(&b, "+++ b/%s\n", newName)
+	}
+
+	// 每个操作之前的旧文件、新文件行数
+	oldPos := make([]int, len(ops)+1)
+	newPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if op.kind != '+' {
+			oldPos[i+1]++
+		}
+		if op.kind != '-' {
+			newPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// 合并间隔不超过 2*diffContext 行的变更
+		start := max(0, i-diffContext)
+		end := i
+		for {
+			j := end + 1
+			for j < len(ops) && ops[j].kind == ' ' {
+				j++
+			}
+			if j < len(ops) && j-end-1 <= 2*diffContext {
+				end = j
+				continue
+			}
+			break
+		}
+		stop := min(len(ops), end+diffContext+1)
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n",
+			hunkRange(oldPos[start], oldPos[stop]-oldPos[start]),
+			hunkRange(newPos[start], newPos[stop]-newPos[start]))
+		for _, op := range ops[start:stop] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.text)
+			b.WriteByte('\n')
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+// hunkRange 格式化 hunk 头中的行范围（pos 为范围之前的行数）
+func hunkRange(pos, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", pos)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", pos+1)
+	}
+	return fmt.Sprintf("%d,%d", pos+1, count)
+}
+
+// noNewlineMarker 追加在没有换行结尾的最后一行之后。行内不会出现 "\n"，
+// 因此只差结尾换行的两行比较时不相等，输出时与 diff -u 一样在该行之后显示标记
+const noNewlineMarker = "\n\\ No newline at end of file"
+
+// splitLines 按行拆分；最后一行没有换行结尾时追加 noNewlineMarker
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if !strings.HasSuffix(s, "\n") {
+		lines[len(lines)-1] += noNewlineMarker
+	}
+	return lines
+}
+
+// diffLines 使用 Myers 算法计算行级最短编辑序列
+func diffLines(a, b []string) []diffOp {
+	// 去掉公共前缀和后缀，减少计算量
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// maxDiffEdits myers 搜索的最大编辑距离。trace 占用 O(D²) 内存，超过时退化为整体删除再整体新增
+const maxDiffEdits = 1000
+
+// myers 返回 a 到 b 的编辑序列
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(a, b)
+	}
+
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	// trace[d] 是第 d 轮开始前 k ∈ [-d, d] 的 v，回溯时用 trace[d][k+d] 访问
+	var trace [][]int
+
+	found := -1
+	for d := 0; d <= n+m && found < 0; d++ {
+		if d > maxDiffEdits {
+			return replaceAll(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = d
+				break
+			}
+		}
+	}
+
+	// 从终点回溯
+	var ops []diffOp
+	x, y := n, m
+	for d := found; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// replaceAll 删除 a 的全部行再新增 b 的全部行（纯新增、纯删除或差异过大时使用）
+func replaceAll(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// applyOps 从编辑序列还原旧文件和新文件
+func applyOps(ops []diffOp) (before, after []string) {
+	for _, op := range ops {
+		if op.kind != '+' {
+			before = append(before, op.text)
+		}
+		if op.kind != '-' {
+			after = append(after, op.text)
+		}
+	}
+	return before, after
+}
+
+// editCount 返回编辑序列中新增和删除的行数
+func editCount(ops []diffOp) int {
+	n := 0
+	for _, op := range ops {
+		if op.kind != ' ' {
+			n++
+		}
+	}
+	return n
+}
+
+// numberedLines 生成 prefix0 ... prefix(n-1)
+func numberedLines(prefix string, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return lines
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []string
+		edits int // 最短编辑距离
+	}{
+		{"相同", []string{"a", "b"}, []string{"a", "b"}, 0},
+		{"都为空", nil, nil, 0},
+		{"新建文件", nil, []string{"a", "b", "c"}, 3},
+		{"删除文件", []string{"a", "b"}, nil, 2},
+		{"中间修改", []string{"a", "b", "c"}, []string{"a", "x", "c"}, 2},
+		{"插入与删除", []string{"a", "b", "c", "d"}, []string{"b", "c", "e", "d"}, 2},
+		{"经典示例", strings.Split("ABCABBA", ""), strings.Split("CBABAC", ""), 5},
+		{"完全不同", []string{"a", "b"}, []string{"c", "d", "e"}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := diffLines(tt.a, tt.b)
+			before, after := applyOps(ops)
+			if strings.Join(before, "\n") != strings.Join(tt.a, "\n") || strings.Join(after, "\n") != strings.Join(tt.b, "\n") {
+				t.Fatalf("编辑序列无法还原输入: %v", ops)
+			}
+			if got := editCount(ops); got != tt.edits {
+				t.Errorf("编辑距离 %d，期望 %d", got, tt.edits)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	// 新建 5000 行的文件：纯新增，不进入 Myers 搜索
+	ops := diffLines(nil, numberedLines("line", 5000))
+	if len(ops) != 5000 || editCount(ops) != 5000 {
+		t.Fatalf("新建文件应为 5000 行新增，得到 %d 项", len(ops))
+	}
+
+	// 每隔一行修改一次：编辑距离 500，走完整的 Myers 回溯
+	a, b := numberedLines("line", 500), numberedLines("line", 500)
+	for i := 0; i < len(b); i += 2 {
+		b[i] = "changed"
+	}
+	ops = diffLines(a, b)
+	before, after := applyOps(ops)
+	if strings.Join(before, "\n") != strings.Join(a, "\n") || strings.Join(after, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("编辑序列无法还原输入")
+	}
+	if got := editCount(ops); got != 500 {
+		t.Errorf("编辑距离 %d，期望 500", got)
+	}
+
+	// 差异超过 maxDiffEdits 时退化为整体替换，结果仍然正确
+	a, b = numberedLines("old", 3000), numberedLines("new", 3000)
+	ops = diffLines(a, b)
+	before, after = applyOps(ops)
+	if len(before) != 3000 || len(after) != 3000 || before[0] != "old0" || after[2999] != "new2999" {
+		t.Fatalf("整体替换的结果不正确")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	got := unifiedDiff("f.txt", "f.txt", "a\nb\nc\n", "a\nx\nc\n")
+	want := "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"
+	if got != want {
+		t.Errorf("unifiedDiff =\n%s\n期望\n%s", got, want)
+	}
+
+	got = unifiedDiff("", "new.txt", "", "a\nb\n")
+	want = "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n"
+	if got != want {
+		t.Errorf("新建文件 unifiedDiff =\n%s\n期望\n%s", got, want)
+	}
+
+	// 只差结尾换行：与 diff -u 相同，在没有换行的行之后输出标记
+	got = unifiedDiff("f.txt", "f.txt", "a\nb\nc\n", "a\nb\nc")
+	want = "--- a/f.txt\n+++ b/f.txt\n@@ -1,3 +1,3 @@\n a\n b\n-c\n+c\n\\ No newline at end of file\n"
+	if got != want {
+		t.Errorf("删除结尾换行 unifiedDiff =\n%s\n期望\n%s", got, want)
+	}
+
+	got = unifiedDiff("f.txt", "f.txt", "x\ny", "x\nz")
+	want = "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n x\n-y\n\\ No newline at end of file\n+z\n\\ No newline at end of file\n"
+	if got != want {
+		t.Errorf("两边都没有结尾换行 unifiedDiff =\n%s\n期望\n%s", got, want)
+	}
+
+	if got := unifiedDiff("f", "f", "same\n", "same\n"); got != "" {
+		t.Errorf("内容相同时应返回空字符串，得到 %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// ErrorCode 稳定的错误码，客户端应根据它而不是 error 文本判断失败原因
+type ErrorCode string
+
+// 错误码定义
+const (
+	CodeInvalidRequest     ErrorCode = "INVALID_REQUEST"
+	CodeUnknownAction      ErrorCode = "UNKNOWN_ACTION"
+	CodeUnsupportedVersion ErrorCode = "UNSUPPORTED_VERSION"
+	CodeUnauthorized       ErrorCode = "UNAUTHORIZED"
+	CodeForbidden          ErrorCode = "FORBIDDEN"
+	CodeQuotaExceeded      ErrorCode = "QUOTA_EXCEEDED"
+	CodeInputTooLarge      ErrorCode = "INPUT_TOO_LARGE"
+	CodeSessionNotFound    ErrorCode = "SESSION_NOT_FOUND"
+	CodeSessionExists      ErrorCode = "SESSION_EXISTS"
+	CodeInvalidState       ErrorCode = "INVALID_STATE"
+	CodeCursorNotFound     ErrorCode = "CURSOR_NOT_FOUND"
+	CodeTranscriptNotFound ErrorCode = "TRANSCRIPT_NOT_FOUND"
+	CodeNoResult           ErrorCode = "NO_RESULT"
+	CodeSchemaValidation   ErrorCode = "SCHEMA_VALIDATION_FAILED"
+	CodeTimeout            ErrorCode = "TIMEOUT"
+	CodeTmuxFailure        ErrorCode = "TMUX_FAILURE"
+	CodeClaudeNotFound     ErrorCode = "CLAUDE_NOT_FOUND"
+	CodeInternal           ErrorCode = "INTERNAL"
+)
+
+// errorCodeList 所有错误码（用于 OpenAPI 文档）
+var errorCodeList = []ErrorCode{
+	CodeInvalidRequest, CodeUnknownAction, CodeUnsupportedVersion, CodeUnauthorized, CodeForbidden,
+	CodeQuotaExceeded, CodeInputTooLarge,
+	CodeSessionNotFound, CodeSessionExists, CodeInvalidState, CodeCursorNotFound, CodeTranscriptNotFound,
+	CodeNoResult, CodeSchemaValidation, CodeTimeout, CodeTmuxFailure, CodeClaudeNotFound, CodeInternal,
+}
+
+// API 版本：服务端支持 MinAPIVersion 到 APIVersion 之间的版本。
+// 客户端通过 APIVersionHeader 请求头（或请求中的 api_version 字段）声明自己使用的版本，
+// 不支持时返回 UNSUPPORTED_VERSION；所有响应都带有服务端的版本。
+const (
+	APIVersion       = 1
+	MinAPIVersion    = 1
+	APIVersionHeader = "Claude-PTY-API-Version"
+)
+
+// errorCodes 错误与错误码的对应关系，按顺序匹配
+var errorCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{ErrSessionNotFound, CodeSessionNotFound},
+	{ErrSessionExists, CodeSessionExists},
+	{ErrTurnInProgress, CodeInvalidState},
+	{ErrAuditDisabled, CodeInvalidState},
+	{ErrInvalidRequest, CodeInvalidRequest},
+	{ErrUnknownAction, CodeUnknownAction},
+	{ErrUnsupportedVersion, CodeUnsupportedVersion},
+	{ErrUnauthorized, CodeUnauthorized},
+	{ErrForbidden, CodeForbidden},
+	{ErrQuotaExceeded, CodeQuotaExceeded},
+	{ErrInputTooLarge, CodeInputTooLarge},
+	{ErrCursorNotFound, CodeCursorNotFound},
+	{ErrTranscriptNotFound, CodeTranscriptNotFound},
+	{ErrNoResult, CodeNoResult},
+	{ErrNoJSON, CodeNoResult},
+	{ErrSchemaValidation, CodeSchemaValidation},
+	{ErrTimeout, CodeTimeout},
+	{ErrTmuxFailed, CodeTmuxFailure},
+	{ErrClaudeNotFound, CodeClaudeNotFound},
+}
+
+// errorCode 返回失败响应的错误码；没有原始错误的失败是参数校验失败
+func errorCode(resp Response) ErrorCode {
+	if resp.err == nil {
+		return CodeInvalidRequest
+	}
+	for _, c := range errorCodes {
+		if errors.Is(resp.err, c.err) {
+			return c.code
+		}
+	}
+	return CodeInternal
+}
+
+// httpStatus 返回错误码对应的 HTTP 状态码
+func (c ErrorCode) httpStatus() int {
+	switch c {
+	case CodeInvalidRequest, CodeUnknownAction, CodeUnsupportedVersion, CodeCursorNotFound:
+		return http.StatusBadRequest
+	case CodeUnauthorized:
+		return http.StatusUnauthorized
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeQuotaExceeded:
+		return http.StatusTooManyRequests
+	case CodeInputTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeSessionNotFound, CodeTranscriptNotFound:
+		return http.StatusNotFound
+	case CodeSessionExists, CodeInvalidState:
+		return http.StatusConflict
+	case CodeNoResult, CodeSchemaValidation:
+		return http.StatusUnprocessableEntity
+	case CodeTimeout:
+		return http.StatusGatewayTimeout
+	case CodeClaudeNotFound:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// supportedVersion 判断客户端声明的 API 版本是否受支持（0 表示未声明）
+func supportedVersion(version int) bool {
+	return version == 0 || (version >= MinAPIVersion && version <= APIVersion)
+}
+
+// parseVersionHeader 解析 API 版本请求头，未设置时返回 0
+func parseVersionHeader(value string) (int, bool) {
+	if value == "" {
+		return 0, true
+	}
+	version, err := strconv.Atoi(value)
+	return version, err == nil && supportedVersion(version)
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// subscriberBuffer 每个订阅者的事件缓冲数量，缓冲满时丢弃新事件（订阅者可以用 cursor 重新同步消息）
+const subscriberBuffer = 256
+
+// eventBus 向订阅者分发会话事件
+type eventBus struct {
+	subscribers map[*subscriber]struct{}
+	mu          sync.Mutex
+}
+
+// subscriber 表示一个事件订阅者，sessionID 为空表示订阅所有会话
+type subscriber struct {
+	sessionID string
+	ch        chan *Event
+}
+
+// newEventBus 创建事件总线
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[*subscriber]struct{})}
+}
+
+// subscribe 订阅事件，返回事件 channel 和取消函数
+func (b *eventBus) subscribe(sessionID string) (<-chan *Event, func()) {
+	sub := &subscriber{sessionID: sessionID, ch: make(chan *Event, subscriberBuffer)}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[sub]; ok {
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// publish 发布事件，不阻塞
+func (b *eventBus) publish(event *Event) {
+	if event.Time == "" {
+		event.Time = time.Now().Format(time.RFC3339Nano)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if sub.sessionID != "" && sub.sessionID != event.SessionID {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe 订阅会话事件（sessionID 为空表示所有会话）
+func (sm *SessionManager) Subscribe(sessionID string) (<-chan *Event, func()) {
+	return sm.events.subscribe(sessionID)
+}
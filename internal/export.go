@@ -0,0 +1,385 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+)
+
+// 导出格式
+const (
+	ExportMarkdown = "markdown"
+	ExportHTML     = "html"
+)
+
+// exportDocument 导出文档的内容
+type exportDocument struct {
+	Session  *SessionInfo
+	Usage    string // 会话总用量摘要
+	Exported string
+	Blocks   []*exportBlock
+}
+
+// exportBlock 导出文档中的一条消息
+type exportBlock struct {
+	Type      string // user, assistant, thinking, tool, tool_result
+	Time      string
+	Model     string
+	Sidechain bool
+	Content   string
+	ToolName  string
+	Summary   string      // tool 输入摘要（命令、文件路径等）
+	Input     string      // tool 输入（格式化的 JSON）
+	Result    *ToolResult // tool 返回值
+	Usage     string      // 所属 API 响应的用量摘要（只出现在响应的最后一条消息上）
+}
+
+// ExportTranscript 将会话的完整对话渲染为 Markdown 或 HTML（format 为空时使用 Markdown）。
+// thinking 为 true 时包含 thinking 块。
+func (sm *SessionManager) ExportTranscript(sessionID, format string, thinking bool) (string, error) {
+	if format == "" || format == "md" {
+		format = ExportMarkdown
+	}
+	if format != ExportMarkdown && format != ExportHTML {
+		return "", fmt.Errorf("unsupported format %q: %w", format, ErrInvalidRequest)
+	}
+
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+	path, err := sm.transcriptPath(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	sm.mu.RLock()
+	pricing := sm.pricing
+	sm.mu.RUnlock()
+
+	blocks, err := readExportBlocks(path, pricing, thinking)
+	if err != nil {
+		return "", err
+	}
+
+	doc := &exportDocument{
+		Session:  session.ToSessionInfo(),
+		Exported: time.Now().Format("2006-01-02 15:04:05"),
+		Blocks:   blocks,
+	}
+	if report, err := sm.RefreshUsage(sessionID); err == nil {
+		doc.Usage = usageSummary(report.Total)
+	}
+
+	if format == ExportHTML {
+		var buf bytes.Buffer
+		if err := exportHTMLTemplate.Execute(&buf, doc); err != nil {
+			return "", fmt.Errorf("render html: %w", err)
+		}
+		return buf.String(), nil
+	}
+	return renderMarkdown(doc), nil
+}
+
+// readExportBlocks 读取整个 jsonl 文件，tool_result 挂到对应的 tool 消息上，
+// 每个 API 响应的用量挂到该响应的最后一条消息上
+func readExportBlocks(path string, pricing map[string]ModelPrice, thinking bool) ([]*exportBlock, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	var blocks []*exportBlock
+	toolUses := make(map[string]*exportBlock)
+	usages := make(map[string]*messageUsage) // API message id -> 用量
+	last := make(map[string]int)             // API message id -> 最后一条消息的下标
+	var order []string
+
+	_, err = scanTranscript(file, 0, func(entry *transcriptEntry, end int64) {
+		for _, msg := range entry.Messages {
+			if msg.Type == "thinking" && !thinking {
+				continue
+			}
+			block := newExportBlock(msg)
+			if msg.Type == "tool" && msg.ToolUseID != "" {
+				toolUses[msg.ToolUseID] = block
+			}
+			blocks = append(blocks, block)
+
+			if entry.MessageID != "" {
+				if _, ok := last[entry.MessageID]; !ok {
+					order = append(order, entry.MessageID)
+				}
+				last[entry.MessageID] = len(blocks) - 1
+			}
+		}
+
+		for _, result := range entry.Results {
+			if block, ok := toolUses[result.ToolUseID]; ok {
+				block.Result = result.Result
+				continue
+			}
+			blocks = append(blocks, newExportBlock(toolResultMessage(entry, result, end)))
+		}
+
+		// 流式输出时同一条消息会写多行，以 output_tokens 最大的一行为准
+		if entry.Usage != nil && entry.MessageID != "" {
+			prev, ok := usages[entry.MessageID]
+			if !ok || entry.Usage.OutputTokens >= prev.usage.OutputTokens {
+				usages[entry.MessageID] = &messageUsage{model: entry.Model, usage: *entry.Usage}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range order {
+		mu, ok := usages[id]
+		if !ok {
+			continue
+		}
+		u := mu.usage
+		if price, ok := priceFor(pricing, mu.model); ok {
+			u.CostUSD = price.cost(&u)
+		}
+		blocks[last[id]].Usage = usageSummary(&u)
+	}
+	return blocks, nil
+}
+
+// newExportBlock 由消息创建导出块
+func newExportBlock(msg *Message) *exportBlock {
+	block := &exportBlock{
+		Type:      msg.Type,
+		Time:      formatTimestamp(msg.Timestamp),
+		Model:     msg.Model,
+		Sidechain: msg.Sidechain,
+		Content:   msg.Content,
+		ToolName:  msg.ToolName,
+		Result:    msg.Result,
+	}
+	if msg.Type == "tool" {
+		block.Summary = toolInputSummary(msg.Input)
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, msg.Input, "", "  "); err == nil {
+			block.Input = buf.String()
+		} else {
+			block.Input = string(msg.Input)
+		}
+	}
+	return block
+}
+
+// Title 返回消息标题
+func (b *exportBlock) Title() string {
+	var title string
+	switch b.Type {
+	case "user":
+		title = "User"
+	case "assistant":
+		title = "Claude"
+	case "thinking":
+		title = "Thinking"
+	case "tool":
+		title = "Tool: " + b.ToolName
+	case "tool_result":
+		title = "Tool result"
+	default:
+		title = b.Type
+	}
+	if b.Sidechain {
+		title += " (subagent)"
+	}
+	return title
+}
+
+// Meta 返回时间和模型
+func (b *exportBlock) Meta() string {
+	var parts []string
+	if b.Time != "" {
+		parts = append(parts, b.Time)
+	}
+	if b.Model != "" {
+		parts = append(parts, b.Model)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// toolInputSummary 提取工具输入中最有代表性的字段作为摘要
+func toolInputSummary(input json.RawMessage) string {
+	var fields map[string]any
+	if err := json.Unmarshal(input, &fields); err != nil {
+		return ""
+	}
+	for _, key := range []string{"command", "file_path", "notebook_path", "pattern", "url", "query", "description"} {
+		if value, ok := fields[key].(string); ok && value != "" {
+			value = strings.Join(strings.Fields(value), " ")
+			if len([]rune(value)) > 80 {
+				value = string([]rune(value)[:80]) + "…"
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// formatTimestamp 将 jsonl 中的 RFC3339 时间转换为本地时间，无法解析时原样返回
+func formatTimestamp(ts string) string {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return ts
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// usageSummary 生成用量摘要
+func usageSummary(u *Usage) string {
+	if u == nil {
+		return ""
+	}
+	summary := fmt.Sprintf("%d tokens (input %d, output %d, cache write %d, cache read %d)",
+		u.TotalTokens(), u.InputTokens, u.OutputTokens, u.CacheCreationInputTokens, u.CacheReadInputTokens)
+	if u.CostUSD > 0 {
+		summary += fmt.Sprintf(" · $%.4f", u.CostUSD)
+	}
+	return summary
+}
+
+// renderMarkdown 渲染 Markdown 文档，tool 调用使用 <details> 折叠输入和返回值
+func renderMarkdown(doc *exportDocument) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Claude session %s\n\n", doc.Session.ID)
+	if doc.Session.ClaudeSessionID != "" {
+		fmt.Fprintf(&b, "- Claude session: `%s`\n", doc.Session.ClaudeSessionID)
+	}
+	fmt.Fprintf(&b, "- CWD: `%s`\n", doc.Session.CWD)
+	fmt.Fprintf(&b, "- Created: %s\n", doc.Session.CreatedAt)
+	if doc.Usage != "" {
+		fmt.Fprintf(&b, "- Usage: %s\n", doc.Usage)
+	}
+	fmt.Fprintf(&b, "- Exported: %s\n", doc.Exported)
+
+	for _, block := range doc.Blocks {
+		b.WriteString("\n---\n\n")
+
+		if block.Type == "tool" {
+			summary := block.Title()
+			if block.Summary != "" {
+				summary += " — " + template.HTMLEscapeString(block.Summary)
+			}
+			if block.Result != nil && block.Result.IsError {
+				summary += " (error)"
+			}
+			fmt.Fprintf(&b, "<details>\n<summary>%s</summary>\n\n", summary)
+			if meta := block.Meta(); meta != "" {
+				fmt.Fprintf(&b, "_%s_\n\n", meta)
+			}
+			b.WriteString("**Input**\n\n")
+			writeFence(&b, "json", block.Input)
+			if block.Result != nil {
+				b.WriteString("\n**Result**\n\n")
+				writeFence(&b, "", block.Result.Content)
+			}
+			b.WriteString("\n</details>\n")
+		} else {
+			fmt.Fprintf(&b, "### %s\n\n", block.Title())
+			if meta := block.Meta(); meta != "" {
+				fmt.Fprintf(&b, "_%s_\n\n", meta)
+			}
+			switch block.Type {
+			case "thinking":
+				b.WriteString("> " + strings.ReplaceAll(block.Content, "\n", "\n> ") + "\n")
+			case "tool_result":
+				writeFence(&b, "", block.Content)
+			default:
+				b.WriteString(block.Content + "\n")
+			}
+		}
+
+		if block.Usage != "" {
+			fmt.Fprintf(&b, "\n<sub>%s</sub>\n", block.Usage)
+		}
+	}
+	return b.String()
+}
+
+// writeFence 写入代码块，围栏长度超过内容中最长的连续反引号
+func writeFence(b *strings.Builder, lang, content string) {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n", fence, lang, strings.TrimRight(content, "\n"), fence)
+}
+
+// exportHTMLTemplate 自包含的 HTML 页面（内联样式，无外部资源）
+var exportHTMLTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Claude session {{.Session.ID}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #1f2328; line-height: 1.5; }
+header { border-bottom: 1px solid #d0d7de; margin-bottom: 1.5em; }
+header dl { display: grid; grid-template-columns: max-content auto; gap: .2em 1em; }
+header dt { color: #656d76; }
+header dd { margin: 0; }
+.msg { border: 1px solid #d0d7de; border-radius: 6px; margin: 1em 0; padding: .6em 1em; }
+.msg h3 { margin: 0; font-size: 1em; }
+.meta, .usage { color: #656d76; font-size: .85em; }
+.user { background: #f6f8fa; }
+.thinking { color: #656d76; font-style: italic; }
+.sidechain { margin-left: 2em; border-style: dashed; }
+.text { white-space: pre-wrap; word-wrap: break-word; }
+pre { background: #f6f8fa; padding: .6em; overflow-x: auto; border-radius: 4px; }
+.error pre.result { background: #ffebe9; }
+summary { cursor: pointer; font-weight: 600; }
+summary code { font-weight: normal; }
+</style>
+</head>
+<body>
+<header>
+<h1>Claude session {{.Session.ID}}</h1>
+<dl>
+{{if .Session.ClaudeSessionID}}<dt>Claude session</dt><dd><code>{{.Session.ClaudeSessionID}}</code></dd>
+{{end}}<dt>CWD</dt><dd><code>{{.Session.CWD}}</code></dd>
+<dt>Created</dt><dd>{{.Session.CreatedAt}}</dd>
+{{if .Usage}}<dt>Usage</dt><dd>{{.Usage}}</dd>
+{{end}}<dt>Exported</dt><dd>{{.Exported}}</dd>
+</dl>
+</header>
+{{range .Blocks}}
+<div class="msg {{.Type}}{{if .Sidechain}} sidechain{{end}}{{if and .Result .Result.IsError}} error{{end}}">
+{{- if eq .Type "tool"}}
+<details>
+<summary>{{.Title}}{{if .Summary}} — <code>{{.Summary}}</code>{{end}}{{if and .Result .Result.IsError}} (error){{end}}</summary>
+{{with .Meta}}<div class="meta">{{.}}</div>{{end}}
+<p>Input</p>
+<pre>{{.Input}}</pre>
+{{if .Result}}<p>Result</p>
+<pre class="result">{{.Result.Content}}</pre>
+{{end}}</details>
+{{- else}}
+<h3>{{.Title}}</h3>
+{{with .Meta}}<div class="meta">{{.}}</div>{{end}}
+{{if eq .Type "tool_result"}}<pre>{{.Content}}</pre>{{else}}<div class="text">{{.Content}}</div>{{end}}
+{{- end}}
+{{with .Usage}}<div class="usage">{{.}}</div>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
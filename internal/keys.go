@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxInputDelay 一次输入中 delay_ms 的总和上限
+const maxInputDelay = 10 * time.Second
+
+// tmuxKeyNames tmux send-keys 支持的按键名称（不含修饰键前缀）
+var tmuxKeyNames = map[string]bool{
+	"Enter": true, "Escape": true, "Tab": true, "BTab": true, "Space": true, "BSpace": true,
+	"Up": true, "Down": true, "Left": true, "Right": true,
+	"Home": true, "End": true, "PageUp": true, "PageDown": true, "PPage": true, "NPage": true,
+	"IC": true, "DC": true, "Insert": true, "Delete": true,
+	"F1": true, "F2": true, "F3": true, "F4": true, "F5": true, "F6": true,
+	"F7": true, "F8": true, "F9": true, "F10": true, "F11": true, "F12": true,
+}
+
+// validKeyName 判断是否为合法的 tmux 按键名称，支持 C-/M-/S- 修饰（如 "C-c"、"M-Enter"）
+func validKeyName(key string) bool {
+	for {
+		switch {
+		case strings.HasPrefix(key, "C-"), strings.HasPrefix(key, "M-"), strings.HasPrefix(key, "S-"):
+			key = key[2:]
+			// 修饰后可以是单个字符
+			if len([]rune(key)) == 1 {
+				return true
+			}
+		default:
+			return tmuxKeyNames[key]
+		}
+	}
+}
+
+// sendKeysArgs 发送一个输入项的 tmux 参数。"--" 结束选项解析，以 "-" 开头的文本不会被当作参数
+func sendKeysArgs(target string, item *InputItem) []string {
+	if item.Text != "" {
+		return []string{"send-keys", "-t", target, "-l", "--", item.Text}
+	}
+	return []string{"send-keys", "-t", target, "--", item.Key}
+}
+
+// validateInputItems 校验输入项：每项只能是 text、key 之一，或仅包含 delay；delay 总和不超过 maxInputDelay
+func validateInputItems(items []*InputItem) error {
+	remainingMs := int(maxInputDelay.Milliseconds())
+	for i, item := range items {
+		if item == nil {
+			return fmt.Errorf("item %d: empty", i)
+		}
+		if item.Text != "" && item.Key != "" {
+			return fmt.Errorf("item %d: text and key are mutually exclusive", i)
+		}
+		if item.Text == "" && item.Key == "" && item.DelayMs <= 0 {
+			return fmt.Errorf("item %d: text, key or delay_ms required", i)
+		}
+		if item.Key != "" && !validKeyName(item.Key) {
+			return fmt.Errorf("item %d: unknown key %q", i, item.Key)
+		}
+		if item.DelayMs < 0 {
+			return fmt.Errorf("item %d: negative delay_ms", i)
+		}
+		if item.DelayMs > remainingMs {
+			return fmt.Errorf("item %d: total delay_ms exceeds %s", i, maxInputDelay)
+		}
+		remainingMs -= item.DelayMs
+	}
+	return nil
+}
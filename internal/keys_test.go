@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendKeysArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		item *InputItem
+		want []string
+	}{
+		{"文本", &InputItem{Text: "hello"}, []string{"send-keys", "-t", "s", "-l", "--", "hello"}},
+		{"以减号开头的文本", &InputItem{Text: "- item one"}, []string{"send-keys", "-t", "s", "-l", "--", "- item one"}},
+		{"按键", &InputItem{Key: "Enter"}, []string{"send-keys", "-t", "s", "--", "Enter"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sendKeysArgs("s", tt.item); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sendKeysArgs = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSendKeysLeadingDash 在真实的 tmux 中发送以 "-" 开头的文本
+func TestSendKeysLeadingDash(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+
+	name := "claude-pty-test-keys"
+	if err := runTmuxCommand("new-session", "-d", "-s", name, "-x", "80", "-y", "10", "cat"); err != nil {
+		t.Fatalf("new-session: %v", err)
+	}
+	defer runTmuxCommand("kill-session", "-t", name)
+
+	for _, item := range []*InputItem{{Text: "- item one"}, {Key: "Enter"}, {Text: "-l"}} {
+		if err := runTmuxCommand(sendKeysArgs(name, item)...); err != nil {
+			t.Fatalf("send %+v: %v", item, err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		out, err := tmuxCmd("capture-pane", "-p", "-t", name).Output()
+		if err == nil && strings.Contains(string(out), "- item one") && strings.Contains(string(out), "-l") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("终端中没有出现发送的文本:\n%s", out)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
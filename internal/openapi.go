@@ -0,0 +1,313 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// queryParams 查询参数的 schema 和说明
+var queryParams = map[string]struct {
+	schema      map[string]any
+	description string
+}{
+	"limit":        {map[string]any{"type": "string"}, "Number of items; for output also >N (last N turns) or .N (last N blocks)"},
+	"cursor":       {map[string]any{"type": "string"}, "Byte offset or entry UUID returned as next_cursor"},
+	"thinking":     {map[string]any{"type": "boolean"}, "Include thinking blocks"},
+	"tree":         {map[string]any{"type": "boolean"}, "Group subagent messages under their Task call"},
+	"format":       {map[string]any{"type": "string", "enum": []string{"markdown", "html"}}, "Export format"},
+	"diff":         {map[string]any{"type": "boolean"}, "Include unified diffs"},
+	"path":         {map[string]any{"type": "string"}, "File path (suffix or glob for search)"},
+	"json":         {map[string]any{"type": "boolean"}, "Extract JSON from the reply"},
+	"q":            {map[string]any{"type": "string"}, "Search text (case-insensitive substring, or regex)"},
+	"regex":        {map[string]any{"type": "boolean"}, "Treat q as a regular expression"},
+	"tool":         {map[string]any{"type": "string"}, "Tool name, * allowed"},
+	"session_id":   {map[string]any{"type": "string"}, "Restrict to one session"},
+	"all_projects": {map[string]any{"type": "boolean"}, "Search every transcript under ~/.claude/projects (requires admin scope)"},
+	"timeout":      {map[string]any{"type": "integer"}, "Wait timeout in seconds"},
+	"force":        {map[string]any{"type": "boolean"}, "Also send Ctrl-C twice"},
+	"since":        {map[string]any{"type": "string", "format": "date-time"}, "Only entries at or after this time (RFC 3339)"},
+	"raw":          {map[string]any{"type": "boolean"}, "Skip secret redaction (requires admin)"},
+}
+
+// OpenAPISpec 生成描述所有路由和协议类型的 OpenAPI 3 文档。
+// 路由来自 restRoutes 和 actions，schema 通过反射从协议类型生成，因此与代码保持同步。
+func OpenAPISpec() map[string]any {
+	g := &schemaGen{components: make(map[string]any)}
+	responseRef := g.schemaFor(reflect.TypeOf(Response{}))
+	requestRef := g.schemaFor(reflect.TypeOf(Request{}))
+	eventRef := g.schemaFor(reflect.TypeOf(Event{}))
+
+	// REST 请求体与 Request 字段相同，但 action 和 session_id 由路由决定，没有必填字段
+	body := make(map[string]any)
+	for k, v := range g.components["Request"].(map[string]any) {
+		if k != "required" {
+			body[k] = v
+		}
+	}
+	body["description"] = "Request fields; action and session_id come from the route"
+	g.components["RequestBody"] = body
+	bodyRef := map[string]any{"$ref": "#/components/schemas/RequestBody"}
+
+	jsonContent := func(schema any) map[string]any {
+		return map[string]any{"application/json": map[string]any{"schema": schema}}
+	}
+	errorResponse := map[string]any{
+		"description": "Failure; see code for the reason",
+		"content":     jsonContent(responseRef),
+	}
+	versionHeader := map[string]any{
+		"name":        APIVersionHeader,
+		"in":          "header",
+		"description": "API version used by the client",
+		"schema":      map[string]any{"type": "integer"},
+	}
+
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var actionDocs []string
+	for _, name := range names {
+		actionDocs = append(actionDocs, "- `"+name+"` ("+string(actions[name].scope)+"): "+actions[name].summary)
+	}
+
+	paths := map[string]map[string]any{
+		"/": {"post": map[string]any{
+			"operationId": "action",
+			"summary":     "Legacy action envelope",
+			"description": "Always returns HTTP 200; check success and code. Actions (required token scope):\n" + strings.Join(actionDocs, "\n"),
+			"parameters":  []any{versionHeader},
+			"requestBody": map[string]any{"required": true, "content": jsonContent(requestRef)},
+			"responses":   map[string]any{"200": map[string]any{"description": "Result", "content": jsonContent(responseRef)}},
+		}},
+		"/list": {"get": map[string]any{
+			"operationId": "list",
+			"summary":     "List sessions (legacy)",
+			"responses":   map[string]any{"200": map[string]any{"description": "Sessions", "content": jsonContent(responseRef)}},
+		}},
+		"/version": {"get": map[string]any{
+			"operationId": "version",
+			"summary":     "Supported API versions (min_api_version to api_version)",
+			"responses":   map[string]any{"200": map[string]any{"description": "Versions", "content": jsonContent(responseRef)}},
+		}},
+		"/openapi.json": {"get": map[string]any{
+			"operationId": "openapi",
+			"summary":     "This document",
+			"responses":   map[string]any{"200": map[string]any{"description": "OpenAPI document"}},
+		}},
+		"/sessions": {"get": map[string]any{
+			"operationId": "listSessions",
+			"summary":     "List sessions",
+			"parameters":  []any{versionHeader},
+			"responses": map[string]any{
+				"200":     map[string]any{"description": "Sessions", "content": jsonContent(responseRef)},
+				"default": errorResponse,
+			},
+		}},
+	}
+
+	events := func(operationID string, params []any) map[string]any {
+		return map[string]any{
+			"operationId": operationID,
+			"summary":     "Stream session events as NDJSON until the client disconnects",
+			"parameters":  params,
+			"responses": map[string]any{
+				"200":     map[string]any{"description": "One event per line", "content": map[string]any{"application/x-ndjson": map[string]any{"schema": eventRef}}},
+				"default": errorResponse,
+			},
+		}
+	}
+	paths["/events"] = map[string]any{"get": events("events", []any{queryParam("session_id"), queryParam("raw")})}
+	paths["/sessions/{id}/events"] = map[string]any{"get": events("sessionEvents", []any{pathParam(), queryParam("raw")})}
+
+	for _, route := range restRoutes {
+		method := strings.ToLower(route.method)
+		var params []any
+		if strings.Contains(route.path, "{id}") {
+			params = append(params, pathParam())
+		}
+		for _, name := range route.query {
+			params = append(params, queryParam(name))
+		}
+		params = append(params, versionHeader)
+
+		success := map[string]any{"description": http.StatusText(route.status)}
+		if route.status != http.StatusNoContent {
+			success["content"] = jsonContent(responseRef)
+		}
+		op := map[string]any{
+			"operationId": operationID(route),
+			"summary":     actions[route.action].summary,
+			"description": "Same as action `" + route.action + "`. Requires scope `" + string(actions[route.action].scope) + "` over TCP.",
+			"parameters":  params,
+			"responses": map[string]any{
+				strconv.Itoa(route.status): success,
+				"default":                  errorResponse,
+			},
+		}
+		if method == "post" || method == "put" {
+			op["requestBody"] = map[string]any{"content": jsonContent(bodyRef)}
+		}
+
+		if paths[route.path] == nil {
+			paths[route.path] = make(map[string]any)
+		}
+		paths[route.path][method] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "claude-pty",
+			"description": "Manage Claude Code sessions running in tmux. The server listens on a Unix socket (default " + SocketPath + ").",
+			"version":     strconv.Itoa(APIVersion),
+		},
+		"servers": []any{map[string]any{"url": "http://localhost"}},
+		"paths":   paths,
+		// Unix socket 不需要认证，TCP 需要 bearer token
+		"security": []any{map[string]any{}, map[string]any{"bearerAuth": []any{}}},
+		"components": map[string]any{
+			"schemas": g.components,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// MarshalOpenAPI 返回格式化的 OpenAPI 文档（与 api/openapi.json 的内容一致）
+func MarshalOpenAPI() ([]byte, error) {
+	data, err := json.MarshalIndent(OpenAPISpec(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// handleOpenAPI 返回 OpenAPI 文档
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	data, err := MarshalOpenAPI()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+	w.Write(data)
+}
+
+// operationID 由方法和路径生成 operationId，如 GET /sessions/{id}/messages -> getSessionMessages
+func operationID(route restRoute) string {
+	id := strings.ToLower(route.method)
+	for _, part := range strings.Split(route.path, "/") {
+		if part == "" || part == "{id}" {
+			continue
+		}
+		if part == "sessions" && strings.Contains(route.path, "{id}") {
+			part = "session"
+		}
+		for _, word := range strings.Split(part, "_") {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+// pathParam 会话 ID 路径参数
+func pathParam() map[string]any {
+	return map[string]any{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "string"}}
+}
+
+// queryParam 查询参数
+func queryParam(name string) map[string]any {
+	p := queryParams[name]
+	return map[string]any{"name": name, "in": "query", "description": p.description, "schema": p.schema}
+}
+
+// schemaGen 通过反射生成 JSON Schema，具名结构体放在 components 中
+type schemaGen struct {
+	components map[string]any
+}
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	errorCodeType  = reflect.TypeOf(ErrorCode(""))
+)
+
+// schemaFor 返回类型 t 的 schema（具名结构体返回 $ref）
+func (g *schemaGen) schemaFor(t reflect.Type) map[string]any {
+	switch t {
+	case rawMessageType:
+		return map[string]any{"description": "Any JSON value"}
+	case errorCodeType:
+		if _, ok := g.components["ErrorCode"]; !ok {
+			codes := make([]string, len(errorCodeList))
+			for i, code := range errorCodeList {
+				codes[i] = string(code)
+			}
+			g.components["ErrorCode"] = map[string]any{"type": "string", "enum": codes}
+		}
+		return map[string]any{"$ref": "#/components/schemas/ErrorCode"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaFor(t.Elem())
+	case reflect.Struct:
+		if _, ok := g.components[t.Name()]; !ok {
+			g.components[t.Name()] = nil // 防止递归类型（Message.Subagent）无限展开
+			g.components[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		return map[string]any{}
+	}
+}
+
+// structSchema 生成结构体的 object schema：按 json tag 命名，没有 omitempty 的字段为 required
+func (g *schemaGen) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schemaFor(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
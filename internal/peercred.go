@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// PeerAccess Unix socket 的访问控制：按 SO_PEERCRED 取得的对端 UID/GID 判断。
+// server 自身的 UID 始终允许连接并拥有管理员权限（hook 以该 UID 运行）。
+type PeerAccess struct {
+	UIDs      []int // 额外允许连接的 UID
+	GIDs      []int // 允许连接的组（主组或附加组）
+	AdminUIDs []int // 额外的管理员 UID：可以操作所有会话
+}
+
+// peerCred Unix socket 对端的身份
+type peerCred struct {
+	PID    int
+	UID    int
+	GID    int
+	Groups []int // 附加组（从 /proc/<pid>/status 读取，失败时为空）
+	Name   string
+}
+
+type peerCredKey struct{} // 连接 context 中的 *peerCred（读取失败时为 nil）
+
+// SetPeerAccess 设置 Unix socket 的访问控制
+func (s *Server) SetPeerAccess(access PeerAccess) {
+	s.peerAccess = access
+}
+
+// unixConnContext 读取连接的对端身份并放入连接 context
+func unixConnContext(ctx context.Context, c net.Conn) context.Context {
+	cred, _ := readPeerCred(c)
+	return context.WithValue(ctx, peerCredKey{}, cred)
+}
+
+// readPeerCred 通过 SO_PEERCRED 读取对端进程的 PID/UID/GID
+func readPeerCred(c net.Conn) (*peerCred, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("not a unix connection: %T", c)
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var ucred *unix.Ucred
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, sockErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if sockErr != nil {
+		return nil, fmt.Errorf("SO_PEERCRED: %w", sockErr)
+	}
+
+	cred := &peerCred{
+		PID:    int(ucred.Pid),
+		UID:    int(ucred.Uid),
+		GID:    int(ucred.Gid),
+		Groups: processGroups(int(ucred.Pid)),
+		Name:   "uid " + strconv.Itoa(int(ucred.Uid)),
+	}
+	if u, err := user.LookupId(strconv.Itoa(cred.UID)); err == nil {
+		cred.Name = u.Username
+	}
+	return cred, nil
+}
+
+// processGroups 读取进程的附加组
+func processGroups(pid int) []int {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := strings.CutPrefix(line, "Groups:")
+		if !ok {
+			continue
+		}
+		var groups []int
+		for _, field := range strings.Fields(value) {
+			if gid, err := strconv.Atoi(field); err == nil {
+				groups = append(groups, gid)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// isAdmin 判断 UID 是否为管理员
+func (a PeerAccess) isAdmin(uid int) bool {
+	return uid == os.Getuid() || slices.Contains(a.AdminUIDs, uid)
+}
+
+// allows 判断对端是否允许连接
+func (a PeerAccess) allows(cred *peerCred) bool {
+	if a.isAdmin(cred.UID) || slices.Contains(a.UIDs, cred.UID) || slices.Contains(a.GIDs, cred.GID) {
+		return true
+	}
+	for _, gid := range cred.Groups {
+		if slices.Contains(a.GIDs, gid) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerCaller 根据对端身份创建调用方：管理员拥有全部权限，其他允许的用户只能操作自己创建的会话
+func (s *Server) peerCaller(cred *peerCred) (*Caller, error) {
+	if !s.peerAccess.allows(cred) {
+		return nil, fmt.Errorf("%w: %s (uid %d) is not allowed to connect", ErrForbidden, cred.Name, cred.UID)
+	}
+	scope := ScopeInput
+	if s.peerAccess.isAdmin(cred.UID) {
+		scope = ScopeAdmin
+	}
+	return &Caller{Name: cred.Name, Scope: scope, UID: cred.UID}, nil
+}
+
+// ParseIDList 解析逗号分隔的 UID/GID 列表（用于命令行参数）
+func ParseIDList(value string) ([]int, error) {
+	var ids []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("invalid id %q", field)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
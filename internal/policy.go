@@ -0,0 +1,328 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 自动授权决策
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+)
+
+// HookEvent 表示 Claude Code hook 通过 stdin 传入的事件数据
+type HookEvent struct {
+	SessionID      string          `json:"session_id,omitempty"`
+	TranscriptPath string          `json:"transcript_path,omitempty"`
+	CWD            string          `json:"cwd,omitempty"`
+	HookEventName  string          `json:"hook_event_name,omitempty"`
+	ToolName       string          `json:"tool_name,omitempty"`
+	ToolInput      json.RawMessage `json:"tool_input,omitempty"`
+	AgentID        string          `json:"agent_id,omitempty"`   // SubagentStart/SubagentStop
+	AgentType      string          `json:"agent_type,omitempty"` // SubagentStart/SubagentStop
+}
+
+// PolicyRule 表示一条自动授权规则。
+// 规则中所有非空条件都满足时才算匹配：
+//
+//	Tool    - 工具名，支持 * 通配（如 "mcp__*"），空表示任意工具
+//	Command - 对 tool_input.command 的正则匹配（Bash 等）
+//	Path    - 对文件路径的 glob 匹配（相对 CWD，支持 **），路径必须位于 CWD 内
+type PolicyRule struct {
+	Decision string `json:"decision"`
+	Tool     string `json:"tool,omitempty"`
+	Command  string `json:"command,omitempty"`
+	Path     string `json:"path,omitempty"`
+
+	commandRe *regexp.Regexp
+	pathRe    *regexp.Regexp
+}
+
+// Policy 表示一组自动授权规则。
+// 任意 deny 规则匹配则拒绝，否则任意 allow 规则匹配则允许，都不匹配时留给人工处理。
+type Policy struct {
+	Rules []*PolicyRule `json:"rules"`
+}
+
+// LoadPolicy 从 JSON 文件加载规则
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := p.Compile(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Compile 校验并预编译所有规则
+func (p *Policy) Compile() error {
+	for i, rule := range p.Rules {
+		if rule.Decision != DecisionAllow && rule.Decision != DecisionDeny {
+			return fmt.Errorf("rule %d: invalid decision %q", i, rule.Decision)
+		}
+		if rule.Command != "" {
+			re, err := regexp.Compile(rule.Command)
+			if err != nil {
+				return fmt.Errorf("rule %d: command: %w", i, err)
+			}
+			rule.commandRe = re
+		}
+		if rule.Path != "" {
+			re, err := globToRegexp(rule.Path)
+			if err != nil {
+				return fmt.Errorf("rule %d: path: %w", i, err)
+			}
+			rule.pathRe = re
+		}
+	}
+	return nil
+}
+
+// Evaluate 对权限请求求值，返回命中的规则；没有命中返回 nil
+func (p *Policy) Evaluate(event *HookEvent, cwd string) *PolicyRule {
+	if p == nil || event == nil {
+		return nil
+	}
+
+	var allow *PolicyRule
+	for _, rule := range p.Rules {
+		if !rule.matches(event, cwd) {
+			continue
+		}
+		if rule.Decision == DecisionDeny {
+			return rule
+		}
+		if allow == nil {
+			allow = rule
+		}
+	}
+	return allow
+}
+
+// evaluatePolicies 依次对多个规则集求值：任一规则集的 deny 都是最终结果，
+// 都没有 deny 时返回第一个命中的 allow
+func evaluatePolicies(event *HookEvent, cwd string, policies ...*Policy) *PolicyRule {
+	var allow *PolicyRule
+	for _, p := range policies {
+		rule := p.Evaluate(event, cwd)
+		if rule == nil {
+			continue
+		}
+		if rule.Decision == DecisionDeny {
+			return rule
+		}
+		if allow == nil {
+			allow = rule
+		}
+	}
+	return allow
+}
+
+// matches 判断规则是否匹配事件
+func (r *PolicyRule) matches(event *HookEvent, cwd string) bool {
+	if r.Tool != "" && r.Tool != "*" {
+		if ok, _ := path.Match(r.Tool, event.ToolName); !ok {
+			return false
+		}
+	}
+
+	if r.commandRe != nil {
+		var input struct {
+			Command string `json:"command"`
+		}
+		if len(event.ToolInput) > 0 {
+			json.Unmarshal(event.ToolInput, &input)
+		}
+		if input.Command == "" || !r.commandRe.MatchString(input.Command) {
+			return false
+		}
+	}
+
+	if r.pathRe != nil {
+		rel, ok := relativeToCWD(toolInputPath(event.ToolInput), cwd)
+		if !ok || !r.pathRe.MatchString(rel) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// toolInputPath 返回工具输入中的文件路径（file_path、notebook_path 或 path）
+func toolInputPath(toolInput json.RawMessage) string {
+	var input struct {
+		FilePath     string `json:"file_path"`
+		NotebookPath string `json:"notebook_path"`
+		Path         string `json:"path"`
+	}
+	if len(toolInput) > 0 {
+		json.Unmarshal(toolInput, &input)
+	}
+	switch {
+	case input.FilePath != "":
+		return input.FilePath
+	case input.NotebookPath != "":
+		return input.NotebookPath
+	default:
+		return input.Path
+	}
+}
+
+// relativeToCWD 返回 target 相对 cwd 的路径；target 不在 cwd 内时返回 false
+func relativeToCWD(target, cwd string) (string, bool) {
+	if target == "" || cwd == "" {
+		return "", false
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(cwd, target)
+	}
+	rel, err := filepath.Rel(filepath.Clean(cwd), filepath.Clean(target))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// globToRegexp 将 glob 转换为正则：* 不跨目录，** 匹配任意层级，? 匹配单个字符
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				// "**/" 也匹配零层目录
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// describeHookEvent 生成权限请求的简短描述（用于历史记录）
+func describeHookEvent(event *HookEvent) string {
+	var input struct {
+		Command  string `json:"command"`
+		FilePath string `json:"file_path"`
+	}
+	if len(event.ToolInput) > 0 {
+		json.Unmarshal(event.ToolInput, &input)
+	}
+	switch {
+	case input.Command != "":
+		return input.Command
+	case input.FilePath != "":
+		return input.FilePath
+	default:
+		return string(event.ToolInput)
+	}
+}
+
+// ApplyPermissionDecision 通过终端回应权限对话框：allow 选择默认的 "Yes"，deny 按 Escape 拒绝。
+// hook 触发时对话框可能尚未渲染，因此先等待对话框出现再发送按键。
+// 对话框没有出现时不发送按键（Escape 会中断正在运行的回合），状态保持 need_permission 留给人工处理。
+func (sm *SessionManager) ApplyPermissionDecision(sessionID string, rule *PolicyRule, event *HookEvent) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if !waitForScreen(session.TmuxSessionName, "Do you want", 3*time.Second) {
+		return fmt.Errorf("permission dialog not shown, %s not applied: %w", rule.Decision, ErrTimeout)
+	}
+
+	if _, err := sm.answerPermission(session, rule.Decision); err != nil {
+		return err
+	}
+	session.addHistory("policy_"+rule.Decision, event.ToolName, describeHookEvent(event))
+	return nil
+}
+
+// RespondPermission 人工回应权限对话框，返回回应后的状态。会话不在 need_permission 状态时返回 ErrInvalidRequest
+func (sm *SessionManager) RespondPermission(sessionID, decision string) (string, error) {
+	if decision != DecisionAllow && decision != DecisionDeny {
+		return "", fmt.Errorf("%w: decision must be allow or deny", ErrInvalidRequest)
+	}
+
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+	session.mu.Lock()
+	status := session.Status
+	session.mu.Unlock()
+	if status != "need_permission" {
+		return status, fmt.Errorf("%w: no pending permission prompt (status: %s)", ErrInvalidRequest, status)
+	}
+
+	status, err = sm.answerPermission(session, decision)
+	if err != nil {
+		return "", err
+	}
+	session.addHistory("permission_"+decision, "", "")
+	return status, nil
+}
+
+// answerPermission 在权限对话框上按键并更新状态：allow 按 Enter 选择默认的 "Yes"，deny 按 Escape 并把状态设为 stopped
+func (sm *SessionManager) answerPermission(session *Session, decision string) (string, error) {
+	key := "Enter"
+	status := "running"
+	if decision == DecisionDeny {
+		key = "Escape"
+		status = "stopped"
+		// 拒绝后 Claude 停在原地等待指示，不自动提交队列中的下一个 prompt
+		session.pauseQueue()
+	}
+
+	session.inputMu.Lock()
+	err := runTmuxCommand("send-keys", "-t", session.TmuxSessionName, key)
+	session.inputMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	session.touch()
+
+	sm.SetStatus(session.ID, status)
+	return status, nil
+}
+
+// waitForScreen 轮询 tmux 屏幕，直到出现 text 或超时
+func waitForScreen(tmuxSessionName, text string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		output, err := tmuxCmd("capture-pane", "-p", "-t", tmuxSessionName).Output()
+		if err == nil && strings.Contains(string(output), text) {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
@@ -1,60 +1,264 @@
 package internal
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+)
 
 // 错误定义
 var (
 	ErrSessionNotFound = errors.New("session not found")
 	ErrSessionExists   = errors.New("session already exists")
 	ErrInvalidRequest  = errors.New("invalid request")
+	ErrTimeout         = errors.New("timed out")
+
+	ErrUnknownAction      = errors.New("unknown action")
+	ErrUnsupportedVersion = errors.New("unsupported API version")
+	ErrTranscriptNotFound = errors.New("session file not found")
+	ErrTmuxFailed         = errors.New("tmux command failed")
+	ErrClaudeNotFound     = errors.New("claude command not found in PATH")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+	ErrQuotaExceeded      = errors.New("quota exceeded")
+	ErrInputTooLarge      = errors.New("input too large")
 )
 
 // Request 表示客户端请求
 type Request struct {
-	Action    string `json:"action"`
-	SessionID string `json:"session_id,omitempty"`
-	CWD       string `json:"cwd,omitempty"`
-	Text      string `json:"text,omitempty"`
-	Status    string `json:"status,omitempty"`
-	Limit     int    `json:"limit,omitempty"`
-	LimitStr  string `json:"limit_str,omitempty"`
+	Action      string          `json:"action"`
+	APIVersion  int             `json:"api_version,omitempty"` // 客户端使用的 API 版本（也可通过请求头声明）
+	SessionID   string          `json:"session_id,omitempty"`
+	CWD         string          `json:"cwd,omitempty"`
+	Text        string          `json:"text,omitempty"`
+	Status      string          `json:"status,omitempty"`
+	Limit       int             `json:"limit,omitempty"`
+	LimitStr    string          `json:"limit_str,omitempty"`
+	Cursor      string          `json:"cursor,omitempty"`       // messages 增量读取游标（字节偏移或条目 UUID）
+	Items       []*InputItem    `json:"items,omitempty"`        // 结构化输入（优先于 text）
+	Timeout     int             `json:"timeout,omitempty"`      // 等待超时（秒）
+	Force       bool            `json:"force,omitempty"`        // interrupt 时额外发送两次 Ctrl-C
+	Thinking    bool            `json:"thinking,omitempty"`     // messages/export/search 是否包含 thinking 块
+	Format      string          `json:"format,omitempty"`       // export 格式：markdown（默认）或 html
+	Query       string          `json:"query,omitempty"`        // search 文本
+	Regex       bool            `json:"regex,omitempty"`        // search 时 query 作为正则表达式
+	Tool        string          `json:"tool,omitempty"`         // search 工具名（支持 * 通配）
+	Path        string          `json:"path,omitempty"`         // search 文件路径（后缀或 glob）；changes 只返回该文件
+	AllProjects bool            `json:"all_projects,omitempty"` // search 所有 ~/.claude/projects 下的会话
+	Diff        bool            `json:"diff,omitempty"`         // changes 是否返回 unified diff
+	Tree        bool            `json:"tree,omitempty"`         // messages 是否将 subagent 消息按 Task 调用分组
+	JSON        bool            `json:"json,omitempty"`         // result 是否从回复中提取 JSON（指定 schema 时自动提取）
+	Schema      json.RawMessage `json:"schema,omitempty"`       // result 使用的 JSON Schema
+	Budget      int64           `json:"token_budget,omitempty"` // 会话 token 预算（输入、输出、缓存写入之和，不含缓存读取）
+	Hook        json.RawMessage `json:"hook,omitempty"`         // hook 从 stdin 收到的事件数据
+	Policy      *Policy         `json:"policy,omitempty"`       // 会话级自动授权规则
+	Since       string          `json:"since,omitempty"`        // audit 只返回该时间（RFC 3339）之后的记录
+	Raw         bool            `json:"raw,omitempty"`          // 返回未脱敏的输出（需要 admin 权限）
+	Decision    string          `json:"decision,omitempty"`     // respond_permission：allow 或 deny
+
+	caller *Caller // 发起请求的调用方，由 server 根据连接填充
+}
+
+// InputItem 表示一个输入项，text 与 key 二选一
+type InputItem struct {
+	Text    string `json:"text,omitempty"`     // 字面文本（send-keys -l）
+	Key     string `json:"key,omitempty"`      // 按键名称，如 Enter、Escape、C-c
+	DelayMs int    `json:"delay_ms,omitempty"` // 发送后等待的毫秒数
 }
 
 // Response 表示服务端响应
 type Response struct {
-	Success  bool          `json:"success"`
-	Error    string        `json:"error,omitempty"`
-	Session  *SessionInfo  `json:"session,omitempty"`
-	Sessions []*SessionInfo `json:"sessions,omitempty"`
-	Output   string        `json:"output,omitempty"`
-	Status   string        `json:"status,omitempty"`
-	Messages []*Message    `json:"messages,omitempty"`
+	Success          bool            `json:"success"`
+	Error            string          `json:"error,omitempty"`
+	Code             ErrorCode       `json:"code,omitempty"`            // 失败时的错误码
+	APIVersion       int             `json:"api_version,omitempty"`     // 服务端 API 版本
+	MinAPIVersion    int             `json:"min_api_version,omitempty"` // 服务端支持的最低 API 版本（/version）
+	Session          *SessionInfo    `json:"session,omitempty"`
+	Sessions         []*SessionInfo  `json:"sessions,omitempty"`
+	Output           string          `json:"output,omitempty"`
+	Status           string          `json:"status,omitempty"`
+	Messages         []*Message      `json:"messages,omitempty"`
+	Queue            []string        `json:"queue,omitempty"`
+	NextCursor       string          `json:"next_cursor,omitempty"`       // messages 下一次增量读取的游标
+	Results          []*SearchResult `json:"results,omitempty"`           // search 结果
+	Changes          []*FileChange   `json:"changes,omitempty"`           // changes 结果
+	Todos            *TodoList       `json:"todos,omitempty"`             // todos 结果
+	Result           json.RawMessage `json:"result,omitempty"`            // result 提取出的 JSON
+	ValidationErrors []string        `json:"validation_errors,omitempty"` // result 的 schema 校验错误
+	Audit            []*AuditEntry   `json:"audit,omitempty"`             // audit 查询结果
+	Redactions       map[string]int  `json:"redactions,omitempty"`        // 每条脱敏规则的命中次数
+	Quotas           *QuotaUsage     `json:"quotas,omitempty"`            // quotas 查询结果
+
+	err error // 失败原因，用于 REST 接口确定 HTTP 状态码
+	raw bool  // 跳过脱敏
 }
 
 // Message 表示对话消息
 type Message struct {
-	Type    string `json:"type"`    // user, assistant, tool
+	Type       string          `json:"type"` // user, assistant, tool, thinking, tool_result
+	Content    string          `json:"content"`
+	UUID       string          `json:"uuid,omitempty"`        // 所在 jsonl 条目的 uuid
+	ParentUUID string          `json:"parent_uuid,omitempty"` // 所在 jsonl 条目的 parentUuid
+	Timestamp  string          `json:"timestamp,omitempty"`
+	Model      string          `json:"model,omitempty"`       // assistant/tool/thinking 消息的模型
+	ToolUseID  string          `json:"tool_use_id,omitempty"` // tool/tool_result 消息的 tool_use id
+	ToolName   string          `json:"tool_name,omitempty"`
+	Input      json.RawMessage `json:"input,omitempty"`  // tool 消息的结构化输入
+	Result     *ToolResult     `json:"result,omitempty"` // tool 消息对应的 tool_result
+	Sidechain  bool            `json:"sidechain,omitempty"`
+	Subagent   []*Message      `json:"subagent,omitempty"` // tree 模式下 Task 调用启动的 subagent 的消息
+
+	end int64 // 所在行结束处的文件偏移
+}
+
+// Event 表示推送给订阅者的会话事件
+type Event struct {
+	Type      string    `json:"type"` // message, status, todos, subagent
+	SessionID string    `json:"session_id"`
+	Time      string    `json:"time"`
+	Status    string    `json:"status,omitempty"`  // status 事件的新状态；subagent 事件为 started 或 stopped
+	Message   *Message  `json:"message,omitempty"` // message 事件的消息
+	Cursor    string    `json:"cursor,omitempty"`  // message 事件之后的 messages 游标
+	Todos     *TodoList `json:"todos,omitempty"`   // todos 事件的最新列表
+
+	Redactions map[string]int `json:"redactions,omitempty"` // 每条脱敏规则的命中次数
+}
+
+// SearchResult 表示一条搜索结果
+type SearchResult struct {
+	SessionID       string `json:"session_id,omitempty"` // 受管理会话的 ID（未受管理的会话为空）
+	ClaudeSessionID string `json:"claude_session_id"`
+	UUID            string `json:"uuid"` // 匹配消息所在 jsonl 条目的 uuid
+	Type            string `json:"type"`
+	ToolName        string `json:"tool_name,omitempty"`
+	Timestamp       string `json:"timestamp,omitempty"`
+	Snippet         string `json:"snippet"`
+}
+
+// FileChange 表示 agent 对一个文件的改动汇总
+type FileChange struct {
+	Path         string `json:"path"`
+	Action       string `json:"action"` // created, edited, deleted
+	Edits        int    `json:"edits"`  // 成功的 Write/Edit/MultiEdit/NotebookEdit 调用次数
+	LastModified string `json:"last_modified,omitempty"`
+	Diff         string `json:"diff,omitempty"`
+	DiffError    string `json:"diff_error,omitempty"` // 无法生成 diff 的原因
+}
+
+// Todo 表示 Claude todo 列表中的一项
+type Todo struct {
+	ID         string `json:"id,omitempty"`
+	Content    string `json:"content"`
+	Status     string `json:"status"` // pending, in_progress, completed
+	ActiveForm string `json:"active_form,omitempty"`
+	Priority   string `json:"priority,omitempty"`
+}
+
+// TodoList 表示会话当前的 todo 列表及进度
+type TodoList struct {
+	Todos      []*Todo `json:"todos"`
+	Completed  int     `json:"completed"`
+	InProgress int     `json:"in_progress"`
+	Total      int     `json:"total"`
+	UpdatedAt  string  `json:"updated_at,omitempty"`
+}
+
+// ToolResult 表示工具调用的返回值
+type ToolResult struct {
 	Content string `json:"content"`
+	IsError bool   `json:"is_error,omitempty"`
+}
+
+// Usage 表示 token 用量
+type Usage struct {
+	InputTokens              int64   `json:"input_tokens"`
+	OutputTokens             int64   `json:"output_tokens"`
+	CacheCreationInputTokens int64   `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64   `json:"cache_read_input_tokens"`
+	CostUSD                  float64 `json:"cost_usd,omitempty"` // 按价格表估算的费用
+}
+
+// UsageReport 会话 token 用量汇总
+type UsageReport struct {
+	Total   *Usage            `json:"total"`
+	ByModel map[string]*Usage `json:"by_model,omitempty"`
+	Budget  int64             `json:"budget,omitempty"` // token 预算（不含缓存读取），0 表示不限制
+}
+
+// HistoryEntry 会话历史记录
+type HistoryEntry struct {
+	Time   string `json:"time"`
+	Event  string `json:"event"` // policy_allow, policy_deny, permission_allow, permission_deny, queue_submit, queue_submit_failed, queue_submit_unconfirmed, budget_exceeded, subagent_start, subagent_stop
+	Tool   string `json:"tool,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// AuditEntry 审计日志中的一条记录：一次修改状态的 API 调用或自动授权决策
+type AuditEntry struct {
+	Time        string    `json:"time"`                   // RFC 3339（UTC）
+	Caller      string    `json:"caller,omitempty"`       // 用户名、token 名称或 policy
+	UID         *int      `json:"uid,omitempty"`          // Unix socket 对端的 UID
+	Scope       Scope     `json:"scope,omitempty"`        // 调用方的权限范围
+	Action      string    `json:"action"`                 // action 名称，自动授权为 policy_allow / policy_deny
+	SessionID   string    `json:"session_id,omitempty"`   // 会话 ID（create 为新会话的 ID）
+	Tool        string    `json:"tool,omitempty"`         // 自动授权的工具名
+	PayloadHash string    `json:"payload_hash,omitempty"` // 请求内容的 SHA-256，内容本身不记录
+	Success     bool      `json:"success"`
+	Code        ErrorCode `json:"code,omitempty"` // 失败时的错误码
+}
+
+// QuotaUsage 配额设置与当前用量
+type QuotaUsage struct {
+	Limits   Limits         `json:"limits"`
+	Sessions int            `json:"sessions"` // 当前会话数（包括正在创建的）
+	Callers  []*CallerUsage `json:"callers"`  // 每个调用方的用量
+}
+
+// CallerUsage 一个调用方的用量
+type CallerUsage struct {
+	Caller            string `json:"caller"`              // uid:<uid> 或 token:<name>
+	Sessions          int    `json:"sessions"`            // 创建且仍在运行的会话数
+	CreatesLastMinute int    `json:"creates_last_minute"` // 最近一分钟创建的会话数
 }
 
 // SessionInfo 会话信息（用于 JSON 序列化）
 type SessionInfo struct {
-	ID               string `json:"id"`
-	ClaudeSessionID string `json:"claude_session_id,omitempty"`
-	CWD              string `json:"cwd"`
-	Status           string `json:"status"`
-	CreatedAt        string `json:"created_at"`
-	LastActivity     string `json:"last_activity"`
+	ID              string          `json:"id"`
+	ClaudeSessionID string          `json:"claude_session_id,omitempty"`
+	CWD             string          `json:"cwd"`
+	Status          string          `json:"status"`
+	CreatedAt       string          `json:"created_at"`
+	LastActivity    string          `json:"last_activity"`
+	History         []*HistoryEntry `json:"history,omitempty"`
+	Queue           []string        `json:"queue,omitempty"`
+	QueuePaused     bool            `json:"queue_paused,omitempty"` // 队列已暂停自动提交
+	Usage           *UsageReport    `json:"usage,omitempty"`
+	Todos           *TodoList       `json:"todos,omitempty"`
+	ActiveSubagents int             `json:"active_subagents,omitempty"`
+	OwnerUID        *int            `json:"owner_uid,omitempty"` // 创建者的 UID（通过 Unix socket 创建时）
 }
 
 // ToSessionInfo 将 Session 转换为 SessionInfo
 func (s *Session) ToSessionInfo() *SessionInfo {
-	return &SessionInfo{
-		ID:               s.ID,
-		ClaudeSessionID:  s.ClaudeSessionID,
-		CWD:              s.CWD,
-		Status:           s.Status,
-		CreatedAt:        s.CreatedAt.Format("2006-01-02 15:04:05"),
-		LastActivity:     s.LastActivity.Format("2006-01-02 15:04:05"),
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info := &SessionInfo{
+		ID:              s.ID,
+		ClaudeSessionID: s.ClaudeSessionID,
+		CWD:             s.CWD,
+		Status:          s.Status,
+		CreatedAt:       s.CreatedAt.Format("2006-01-02 15:04:05"),
+		LastActivity:    s.LastActivity.Format("2006-01-02 15:04:05"),
+		History:         append([]*HistoryEntry(nil), s.History...),
+		Queue:           append([]string(nil), s.Queue...),
+		QueuePaused:     s.queuePaused,
+		Usage:           s.lastUsage,
+		Todos:           s.todos,
+		ActiveSubagents: s.ActiveSubagents,
+	}
+	if s.OwnerUID >= 0 {
+		uid := s.OwnerUID
+		info.OwnerUID = &uid
 	}
+	return info
 }
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	queueSubmitTimeout = 10 * time.Second // 从队列提交 prompt 时等待确认的超时
+	queueRetryDelay    = 2 * time.Second  // 提交失败后首次重试的间隔，之后每次翻倍
+	queueMaxFailures   = 5                // 连续失败达到此次数后暂停队列
+	maxQueueLength     = 100              // 每个会话队列中最多等待的 prompt 数
+)
+
+// Enqueue 将 prompt 加入会话队列。会话空闲且没有正在提交的 prompt 时立即提交队首。
+func (sm *SessionManager) Enqueue(sessionID string, texts ...string) ([]string, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if len(session.Queue)+len(texts) > maxQueueLength {
+		return nil, fmt.Errorf("%w: queue holds %d prompts (limit %d)", ErrQuotaExceeded, len(session.Queue), maxQueueLength)
+	}
+	session.Queue = append(session.Queue, texts...)
+	// 再次入队表示调用方希望继续，恢复被暂停的队列
+	session.queuePaused = false
+	session.queueFailures = 0
+	if session.Status == "stopped" {
+		sm.dispatchQueueLocked(session)
+	}
+	return append([]string(nil), session.Queue...), nil
+}
+
+// GetQueue 返回会话队列中待提交的 prompt
+func (sm *SessionManager) GetQueue(sessionID string) ([]string, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return append([]string(nil), session.Queue...), nil
+}
+
+// ClearQueue 清空会话队列，返回被清除的 prompt 数量
+func (sm *SessionManager) ClearQueue(sessionID string) (int, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	n := len(session.Queue)
+	session.Queue = nil
+	return n, nil
+}
+
+// pauseQueue 暂停自动提交，直到新回合开始或再次入队
+func (s *Session) pauseQueue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queuePaused = true
+}
+
+// dispatchQueueLocked 取出队首 prompt 并异步提交，调用方需持有 session.mu
+func (sm *SessionManager) dispatchQueueLocked(session *Session) {
+	if session.dispatching || session.queuePaused || len(session.Queue) == 0 {
+		return
+	}
+
+	text := session.Queue[0]
+	session.Queue = session.Queue[1:]
+	session.dispatching = true
+
+	go func() {
+		_, err := sm.SubmitToSession(session.ID, text, queueSubmitTimeout)
+
+		session.mu.Lock()
+		session.dispatching = false
+		if err == nil {
+			session.queueFailures = 0
+			session.mu.Unlock()
+			session.addHistory("queue_submit", "", text)
+			return
+		}
+
+		// 等待确认超时：文本和 Enter 已经发出，Claude 可能已经收到，重试会重复提交。
+		// 丢弃该 prompt 并暂停队列，由调用方查看会话后决定如何继续
+		if errors.Is(err, ErrTimeout) {
+			session.queueFailures = 0
+			session.queuePaused = true
+			session.mu.Unlock()
+			session.addHistory("queue_submit_unconfirmed", "", text)
+			sm.logger.Printf("queued prompt for session %s not confirmed, dropped and queue paused: %v", session.ID, err)
+			return
+		}
+
+		// 文本没有送达（tmux 失败等），放回队首并按指数退避重试，连续失败过多时暂停队列
+		session.Queue = append([]string{text}, session.Queue...)
+		session.queueFailures++
+		failures := session.queueFailures
+		if failures >= queueMaxFailures {
+			session.queuePaused = true
+		}
+		session.mu.Unlock()
+
+		session.addHistory("queue_submit_failed", "", err.Error())
+		if failures >= queueMaxFailures {
+			sm.logger.Printf("submit queued prompt to session %s failed %d times, queue paused: %v", session.ID, failures, err)
+			return
+		}
+		delay := queueRetryDelay << (failures - 1)
+		sm.logger.Printf("submit queued prompt to session %s (attempt %d), retry in %s: %v", session.ID, failures, delay, err)
+		time.AfterFunc(delay, func() { sm.retryQueue(session) })
+	}()
+}
+
+// retryQueue 会话仍然存在且空闲时重新提交队首
+func (sm *SessionManager) retryQueue(session *Session) {
+	if current, err := sm.GetSession(session.ID); err != nil || current != session {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.Status == "stopped" {
+		sm.dispatchQueueLocked(session)
+	}
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits 会话配额与速率限制，0 表示不限制
+type Limits struct {
+	MaxSessions          int `json:"max_sessions"`            // 全局并发会话数
+	MaxSessionsPerCaller int `json:"max_sessions_per_caller"` // 每个调用方（UID 或 token）的并发会话数
+	CreatesPerMinute     int `json:"creates_per_minute"`      // 每个调用方每分钟可以创建的会话数
+	MaxInputBytes        int `json:"max_input_bytes"`         // 单次 input/submit/enqueue 的最大字节数
+}
+
+const (
+	defaultMaxBodyBytes = 8 << 20  // 没有设置 MaxInputBytes 时请求体的字节上限
+	bodyOverheadBytes   = 64 << 10 // 请求体中文本以外的字段（规则、参数等）预留的字节数
+)
+
+// quotaTracker 记录每个调用方最近的创建时间和正在创建的会话
+type quotaTracker struct {
+	mu      sync.Mutex
+	limits  Limits
+	pending map[string]int         // 正在创建（尚未出现在会话列表中）的会话数
+	creates map[string][]time.Time // 最近一分钟的创建时间
+	version int                    // 每次释放占用时递增，用于检测统计会话期间是否有会话注册
+}
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{
+		pending: make(map[string]int),
+		creates: make(map[string][]time.Time),
+	}
+}
+
+// quotaKey 配额统计使用的调用方标识：Unix socket 为 uid:<uid>，TCP 为 token:<name>
+func (c *Caller) quotaKey() string {
+	if c == nil {
+		return "local"
+	}
+	if c.UID < 0 {
+		return "token:" + c.Name
+	}
+	return "uid:" + strconv.Itoa(c.UID)
+}
+
+// SetLimits 设置会话配额与速率限制
+func (s *Server) SetLimits(limits Limits) {
+	s.quotas.mu.Lock()
+	defer s.quotas.mu.Unlock()
+	s.quotas.limits = limits
+}
+
+// recentCreates 清理并返回 key 最近一分钟的创建时间，调用方需持有 q.mu
+func (q *quotaTracker) recentCreates(key string, now time.Time) []time.Time {
+	times := q.creates[key]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= time.Minute {
+		i++
+	}
+	times = times[i:]
+	if len(times) == 0 {
+		delete(q.creates, key)
+	} else {
+		q.creates[key] = times
+	}
+	return times
+}
+
+// lockWithSessions 统计现有会话（总数和按创建者），返回时持有 q.mu。
+// 列出会话可能要等待正在创建的会话（CreateSession 启动 tmux 期间持有 sm.mu），因此不在持有 q.mu 时进行；
+// 统计期间有占用被释放（会话完成注册）时重新统计，保证和 pending 一致
+func (s *Server) lockWithSessions() (total int, byCreator map[string]int) {
+	q := s.quotas
+	for {
+		q.mu.Lock()
+		version := q.version
+		q.mu.Unlock()
+
+		sessions := s.sessionMgr.ListSessions()
+		byCreator = make(map[string]int)
+		for _, session := range sessions {
+			if key := session.creator(); key != "" {
+				byCreator[key]++
+			}
+		}
+
+		q.mu.Lock()
+		if q.version == version {
+			return len(sessions), byCreator
+		}
+		q.mu.Unlock()
+	}
+}
+
+// reserveSession 检查调用方能否再创建一个会话，可以时占用一个名额。
+// 会话注册时（或创建失败后）调用返回的函数释放占用，之后会话本身计入配额；重复调用只释放一次
+func (s *Server) reserveSession(caller *Caller) (func(), error) {
+	q := s.quotas
+	key := caller.quotaKey()
+
+	total, byCreator := s.lockWithSessions()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	recent := q.recentCreates(key, now)
+	if limit := q.limits.CreatesPerMinute; limit > 0 && len(recent) >= limit {
+		retry := recent[0].Add(time.Minute).Sub(now).Round(time.Second)
+		return nil, fmt.Errorf("%w: %s created %d sessions in the last minute (limit %d), retry in %s",
+			ErrQuotaExceeded, key, len(recent), limit, retry)
+	}
+
+	mine := byCreator[key] + q.pending[key]
+	for _, n := range q.pending {
+		total += n
+	}
+	if limit := q.limits.MaxSessions; limit > 0 && total >= limit {
+		return nil, fmt.Errorf("%w: %d sessions running (limit %d)", ErrQuotaExceeded, total, limit)
+	}
+	if limit := q.limits.MaxSessionsPerCaller; limit > 0 && mine >= limit {
+		return nil, fmt.Errorf("%w: %s has %d sessions (limit %d per caller)", ErrQuotaExceeded, key, mine, limit)
+	}
+
+	q.creates[key] = append(recent, now)
+	q.pending[key]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if q.pending[key]--; q.pending[key] <= 0 {
+				delete(q.pending, key)
+			}
+			q.version++
+		})
+	}, nil
+}
+
+// checkInputSize 检查 input/submit/enqueue 的文本是否超过 MaxInputBytes
+func (s *Server) checkInputSize(req Request) error {
+	s.quotas.mu.Lock()
+	limit := s.quotas.limits.MaxInputBytes
+	s.quotas.mu.Unlock()
+	if limit <= 0 {
+		return nil
+	}
+
+	size := len(req.Text)
+	for _, item := range req.Items {
+		size += len(item.Text)
+	}
+	if size > limit {
+		return fmt.Errorf("%w: input is %d bytes (limit %d)", ErrInputTooLarge, size, limit)
+	}
+	return nil
+}
+
+// maxBodyBytes 请求体的字节上限。JSON 转义最多使文本膨胀 6 倍（\u00XX），按此从 MaxInputBytes 推算
+func (s *Server) maxBodyBytes() int64 {
+	s.quotas.mu.Lock()
+	limit := s.quotas.limits.MaxInputBytes
+	s.quotas.mu.Unlock()
+	if limit <= 0 {
+		return defaultMaxBodyBytes
+	}
+	return int64(limit)*6 + bodyOverheadBytes
+}
+
+// readBody 读取请求体，超过 maxBodyBytes 时返回 ErrInputTooLarge
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodyBytes()))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, fmt.Errorf("%w: request body exceeds %d bytes", ErrInputTooLarge, tooLarge.Limit)
+	}
+	return body, err
+}
+
+// sendBodyError 返回读取请求体失败的错误
+func (s *Server) sendBodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrInputTooLarge) {
+		s.sendError(w, http.StatusRequestEntityTooLarge, CodeInputTooLarge, err.Error())
+		return
+	}
+	s.sendError(w, http.StatusBadRequest, CodeInvalidRequest, "read request body")
+}
+
+// handleQuotas 返回配额设置以及每个调用方当前的会话数和最近一分钟的创建次数
+func (s *Server) handleQuotas(req Request) Response {
+	q := s.quotas
+	total, byCreator := s.lockWithSessions()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	usage := &QuotaUsage{Limits: q.limits, Sessions: total}
+	callers := make(map[string]*CallerUsage)
+	callerUsage := func(key string) *CallerUsage {
+		if callers[key] == nil {
+			callers[key] = &CallerUsage{Caller: key}
+		}
+		return callers[key]
+	}
+
+	for key, n := range byCreator {
+		callerUsage(key).Sessions += n
+	}
+	for key, n := range q.pending {
+		usage.Sessions += n
+		callerUsage(key).Sessions += n
+	}
+	for key := range q.creates {
+		if recent := q.recentCreates(key, now); len(recent) > 0 {
+			callerUsage(key).CreatesLastMinute = len(recent)
+		}
+	}
+
+	usage.Callers = make([]*CallerUsage, 0, len(callers))
+	for _, c := range callers {
+		usage.Callers = append(usage.Callers, c)
+	}
+	sort.Slice(usage.Callers, func(i, j int) bool { return usage.Callers[i].Caller < usage.Callers[j].Caller })
+	return Response{Success: true, Quotas: usage}
+}
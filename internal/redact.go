@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// RedactionRule 一条脱敏规则：匹配 pattern 的文本被替换为 [REDACTED:name]。
+// pattern 含捕获组时只替换第一个捕获组，用于保留 "password=" 之类的前缀
+type RedactionRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// RedactionConfig 脱敏配置文件
+type RedactionConfig struct {
+	Builtin *bool            `json:"builtin,omitempty"` // 是否启用内置检测器，默认启用
+	Rules   []*RedactionRule `json:"rules"`             // 额外的规则，在内置检测器之后应用
+}
+
+// builtinRedactionRules 内置的常见密钥格式检测器。顺序有意义：更具体的格式在前
+var builtinRedactionRules = []*RedactionRule{
+	{Name: "private_key", Pattern: `-----BEGIN[A-Z ]*PRIVATE KEY-----[\s\S]*?-----END[A-Z ]*PRIVATE KEY-----`},
+	{Name: "anthropic_key", Pattern: `\bsk-ant-[A-Za-z0-9_\-]{20,}`},
+	{Name: "openai_key", Pattern: `\bsk-(?:proj-)?[A-Za-z0-9_\-]{20,}`},
+	{Name: "aws_access_key", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "github_token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`},
+	{Name: "slack_token", Pattern: `\bxox[abprs]-[A-Za-z0-9\-]{10,}`},
+	{Name: "google_api_key", Pattern: `\bAIza[0-9A-Za-z_\-]{35}`},
+	{Name: "stripe_key", Pattern: `\b[rs]k_(?:live|test)_[0-9A-Za-z]{16,}`},
+	{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_\-]{8,}\.eyJ[A-Za-z0-9_\-]{8,}\.[A-Za-z0-9_\-]{8,}`},
+	{Name: "bearer_token", Pattern: `(?i)\bbearer\s+([A-Za-z0-9_\-.~+/]{16,}=*)`},
+	{Name: "secret_assignment", Pattern: `(?i)(?:api[_-]?key|secret|access[_-]?token|auth[_-]?token|password|passwd)["']?\s*[=:]\s*["']?([A-Za-z0-9_\-./+=~]{8,})`},
+}
+
+// Redactor 对返回给客户端的文本做脱敏。nil 表示不脱敏
+type Redactor struct {
+	rules []*RedactionRule
+}
+
+// NewRedactor 编译规则并创建 Redactor
+func NewRedactor(rules []*RedactionRule) (*Redactor, error) {
+	compiled := make([]*RedactionRule, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		compiled[i] = &RedactionRule{Name: rule.Name, Pattern: rule.Pattern, re: re}
+	}
+	return &Redactor{rules: compiled}, nil
+}
+
+// DefaultRedactor 只使用内置检测器的 Redactor
+func DefaultRedactor() *Redactor {
+	r, err := NewRedactor(builtinRedactionRules)
+	if err != nil {
+		panic(err) // 内置规则有误
+	}
+	return r
+}
+
+// LoadRedactor 从 JSON 文件加载脱敏配置
+func LoadRedactor(path string) (*Redactor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read redaction rules: %w", err)
+	}
+
+	var config RedactionConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse redaction rules: %w", err)
+	}
+
+	var rules []*RedactionRule
+	if config.Builtin == nil || *config.Builtin {
+		rules = append(rules, builtinRedactionRules...)
+	}
+	return NewRedactor(append(rules, config.Rules...))
+}
+
+// Rules 返回规则数量
+func (r *Redactor) Rules() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.rules)
+}
+
+// Redact 返回脱敏后的文本，counts 不为 nil 时累加每条规则的命中次数
+func (r *Redactor) Redact(text string, counts map[string]int) string {
+	if r == nil {
+		return text
+	}
+	for _, rule := range r.rules {
+		matches := rule.re.FindAllStringSubmatchIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3] // 只替换第一个捕获组
+			}
+			b.WriteString(text[last:start])
+			b.WriteString("[REDACTED:" + rule.Name + "]")
+			last = end
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+
+		if counts != nil {
+			counts[rule.Name] += len(matches)
+		}
+	}
+	return text
+}
+
+// redactJSON 对 JSON 对象中所有字符串值（不包括键名）脱敏，命中时在顶层加入 redactions 统计。
+// 没有命中时原样返回 data
+func (r *Redactor) redactJSON(data []byte) ([]byte, error) {
+	if r == nil {
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	doc = r.redactValue(doc, counts)
+	if len(counts) == 0 {
+		return data, nil
+	}
+	if obj, ok := doc.(map[string]any); ok {
+		obj["redactions"] = counts
+	}
+	return json.Marshal(doc)
+}
+
+// redactValue 递归脱敏 JSON 值中的字符串
+func (r *Redactor) redactValue(v any, counts map[string]int) any {
+	switch v := v.(type) {
+	case string:
+		return r.Redact(v, counts)
+	case map[string]any:
+		for k, item := range v {
+			v[k] = r.redactValue(item, counts)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = r.redactValue(item, counts)
+		}
+	}
+	return v
+}
+
+// SetRedactor 设置输出脱敏规则，nil 表示不脱敏
+func (s *Server) SetRedactor(redactor *Redactor) {
+	s.redactor = redactor
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrTurnInProgress   = errors.New("turn in progress")
+	ErrNoResult         = errors.New("no assistant reply in latest turn")
+	ErrNoJSON           = errors.New("no valid JSON in reply")
+	ErrSchemaValidation = errors.New("schema validation failed")
+)
+
+// fencedBlockRe 匹配 Markdown 围栏代码块，第 1 组为语言标记，第 2 组为内容
+var fencedBlockRe = regexp.MustCompile("(?s)```([\\w+-]*)[^\\n]*\\n(.*?)\\n?```")
+
+// GetResult 返回最近一个回合（最后一条用户 prompt 之后）中 Claude 的最后一条文本回复。
+// 会话仍在运行或等待授权时返回 ErrTurnInProgress。
+func (sm *SessionManager) GetResult(sessionID string) (*Message, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	status := session.Status
+	session.mu.Unlock()
+	if status != "stopped" {
+		return nil, fmt.Errorf("%w (status: %s)", ErrTurnInProgress, status)
+	}
+
+	messages, _, err := sm.GetMessages(sessionID, 0, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Message
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Sidechain {
+			continue
+		}
+		if msg.Type == "user" {
+			break
+		}
+		if msg.Type == "assistant" && result == nil {
+			result = msg
+		}
+	}
+	if result == nil {
+		return nil, ErrNoResult
+	}
+	return result, nil
+}
+
+// extractJSON 从回复中提取 JSON：优先使用最后一个 json 代码块，其次是最后一个内容为合法 JSON 的代码块，
+// 最后尝试把整条回复作为 JSON
+func extractJSON(text string) (json.RawMessage, error) {
+	blocks := fencedBlockRe.FindAllStringSubmatch(text, -1)
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if strings.EqualFold(blocks[i][1], "json") {
+			content := strings.TrimSpace(blocks[i][2])
+			if !json.Valid([]byte(content)) {
+				return nil, fmt.Errorf("last json block: %w", ErrNoJSON)
+			}
+			return json.RawMessage(content), nil
+		}
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if content := strings.TrimSpace(blocks[i][2]); json.Valid([]byte(content)) {
+			return json.RawMessage(content), nil
+		}
+	}
+	if content := strings.TrimSpace(text); json.Valid([]byte(content)) {
+		return json.RawMessage(content), nil
+	}
+	return nil, ErrNoJSON
+}
+
+// ExtractResult 从回复中提取 JSON 并按 schema（可为空）校验，返回 JSON 和校验错误列表
+func ExtractResult(text string, schema json.RawMessage) (json.RawMessage, []string, error) {
+	var s any
+	if len(schema) > 0 {
+		var err error
+		if s, err = parseSchema(schema); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+	}
+
+	data, err := extractJSON(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s == nil {
+		return data, nil, nil
+	}
+
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, nil, err
+	}
+	return data, validateSchema(s, value, ""), nil
+}
@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// restRoute 一条 REST 路由：请求交给 action 处理，成功时返回 status
+type restRoute struct {
+	method string
+	path   string
+	action string
+	status int
+	query  []string // 支持的查询参数（用于 OpenAPI 文档）
+}
+
+// restRoutes 所有 REST 路由
+var restRoutes = []restRoute{
+	{"POST", "/sessions", "create", http.StatusCreated, nil},
+	{"GET", "/sessions/{id}", "get_info", http.StatusOK, []string{"raw"}},
+	{"DELETE", "/sessions/{id}", "delete", http.StatusNoContent, nil},
+
+	{"GET", "/sessions/{id}/status", "get_status", http.StatusOK, nil},
+	{"PUT", "/sessions/{id}/status", "set_status", http.StatusOK, nil},
+	{"GET", "/sessions/{id}/output", "get", http.StatusOK, []string{"limit", "raw"}},
+	{"POST", "/sessions/{id}/input", "input", http.StatusOK, nil},
+	{"POST", "/sessions/{id}/submit", "submit", http.StatusOK, []string{"timeout"}},
+	{"POST", "/sessions/{id}/interrupt", "interrupt", http.StatusOK, []string{"force", "timeout"}},
+	{"POST", "/sessions/{id}/permission", "respond_permission", http.StatusOK, nil},
+
+	{"GET", "/sessions/{id}/queue", "queue", http.StatusOK, nil},
+	{"POST", "/sessions/{id}/queue", "enqueue", http.StatusOK, nil},
+	{"DELETE", "/sessions/{id}/queue", "clear_queue", http.StatusNoContent, nil},
+
+	{"GET", "/sessions/{id}/messages", "messages", http.StatusOK, []string{"limit", "cursor", "thinking", "tree", "raw"}},
+	{"GET", "/sessions/{id}/export", "export", http.StatusOK, []string{"format", "thinking", "raw"}},
+	{"GET", "/sessions/{id}/changes", "changes", http.StatusOK, []string{"diff", "path", "raw"}},
+	{"GET", "/sessions/{id}/todos", "todos", http.StatusOK, []string{"raw"}},
+	{"GET", "/sessions/{id}/result", "result", http.StatusOK, []string{"json", "raw"}},
+	{"POST", "/sessions/{id}/result", "result", http.StatusOK, nil},
+	{"POST", "/sessions/{id}/subagents", "subagent", http.StatusOK, nil},
+
+	{"PUT", "/sessions/{id}/policy", "set_policy", http.StatusOK, nil},
+	{"PUT", "/sessions/{id}/budget", "set_budget", http.StatusOK, nil},
+
+	{"GET", "/search", "search", http.StatusOK, []string{"q", "regex", "tool", "path", "session_id", "all_projects", "thinking", "limit", "raw"}},
+	{"GET", "/audit", "audit", http.StatusOK, []string{"session_id", "since", "limit"}},
+	{"GET", "/quotas", "quotas", http.StatusOK, nil},
+}
+
+// routes 注册 HTTP 路由：REST 风格的资源接口，以及兼容旧版本的 POST / action 接口
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// 旧接口：始终返回 200，结果看 success 字段
+	mux.HandleFunc("POST /{$}", s.handleRequest)
+	mux.HandleFunc("/list", s.handleList)
+	mux.HandleFunc("GET /events", s.handleEvents)
+	mux.HandleFunc("GET /version", s.handleVersion)
+	mux.HandleFunc("GET /openapi.json", s.handleOpenAPI)
+
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		s.writeREST(w, s.listSessions(), http.StatusOK)
+	})
+	mux.HandleFunc("GET /sessions/{id}/events", s.handleEvents)
+	for _, route := range restRoutes {
+		mux.HandleFunc(route.method+" "+route.path, s.rest(route.action, route.status))
+	}
+
+	// 其他请求也返回 JSON 错误，旧客户端仍然可以按 success 字段判断
+	mux.HandleFunc("/", s.unmatched(mux))
+
+	return mux
+}
+
+// unmatched 处理没有匹配任何路由的请求：路径存在但方法不对时返回 405 和 Allow 头，否则返回 404
+func (s *Server) unmatched(mux *http.ServeMux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var allow []string
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			if _, pattern := mux.Handler(probe); pattern != "/" {
+				allow = append(allow, method)
+			}
+		}
+
+		if len(allow) > 0 {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			s.sendError(w, http.StatusMethodNotAllowed, CodeInvalidRequest,
+				fmt.Sprintf("method %s not allowed for %s", r.Method, r.URL.Path))
+			return
+		}
+		s.sendError(w, http.StatusNotFound, CodeUnknownAction, "no such endpoint: "+r.URL.Path)
+	}
+}
+
+// rest 创建 REST 路由的处理函数：请求体（JSON）、查询参数和路径中的 {id} 合并为 Request 后交给 action 处理，
+// 成功时返回 okStatus，失败时按错误类型返回对应的状态码
+func (s *Server) rest(action string, okStatus int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		body, err := s.readBody(w, r)
+		if err != nil {
+			s.sendBodyError(w, err)
+			return
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				s.sendError(w, http.StatusBadRequest, CodeInvalidRequest, "parse JSON: "+err.Error())
+				return
+			}
+		}
+		if err := parseQuery(r.URL.Query(), &req); err != nil {
+			s.sendError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		req.Action = action
+		req.caller = callerFrom(r.Context())
+		if id := r.PathValue("id"); id != "" {
+			req.SessionID = id
+		}
+
+		resp := s.dispatch(req)
+		if resp.Success && okStatus == http.StatusCreated && resp.Session != nil {
+			w.Header().Set("Location", "/sessions/"+resp.Session.ID)
+		}
+		s.writeREST(w, resp, okStatus)
+	}
+}
+
+// writeREST 写入 REST 响应，204 时不带响应体
+func (s *Server) writeREST(w http.ResponseWriter, resp Response, okStatus int) {
+	status := okStatus
+	if !resp.Success {
+		status = errorCode(resp).httpStatus()
+	}
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(status)
+	s.sendResponse(w, resp)
+}
+
+// parseQuery 将查询参数合并到 Request 中（覆盖请求体中的同名字段）
+func parseQuery(query url.Values, req *Request) error {
+	for key, values := range query {
+		value := values[len(values)-1]
+		var err error
+		switch key {
+		case "session_id":
+			req.SessionID = value
+		case "limit":
+			// output 的 limit 可以是 ">1"、".1" 等格式
+			req.LimitStr = value
+			if n, convErr := strconv.Atoi(value); convErr == nil {
+				req.Limit = n
+			}
+		case "cursor":
+			req.Cursor = value
+		case "format":
+			req.Format = value
+		case "since":
+			req.Since = value
+		case "query", "q":
+			req.Query = value
+		case "tool":
+			req.Tool = value
+		case "path":
+			req.Path = value
+		case "timeout":
+			req.Timeout, err = strconv.Atoi(value)
+		case "thinking":
+			req.Thinking, err = parseBoolParam(value)
+		case "tree":
+			req.Tree, err = parseBoolParam(value)
+		case "diff":
+			req.Diff, err = parseBoolParam(value)
+		case "regex":
+			req.Regex, err = parseBoolParam(value)
+		case "all_projects":
+			req.AllProjects, err = parseBoolParam(value)
+		case "force":
+			req.Force, err = parseBoolParam(value)
+		case "json":
+			req.JSON, err = parseBoolParam(value)
+		case "raw":
+			req.Raw, err = parseBoolParam(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid query parameter %s=%q", key, value)
+		}
+	}
+	return nil
+}
+
+// parseBoolParam 解析布尔查询参数，空值（如 ?diff）视为 true
+func parseBoolParam(value string) (bool, error) {
+	if value == "" {
+		return true, nil
+	}
+	return strconv.ParseBool(value)
+}
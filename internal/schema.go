@@ -0,0 +1,335 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// validateSchema 按 JSON Schema 的常用子集校验 value，返回所有错误（"路径: 原因"）。
+// 支持 type、enum、const、properties、required、additionalProperties、items、
+// minItems/maxItems、minLength/maxLength、pattern、minimum/maximum、
+// exclusiveMinimum/exclusiveMaximum、allOf/anyOf/oneOf/not；其他关键字（$ref、format 等）
+// 由 parseSchema 拒绝，不会被静默忽略。value 需由 encoding/json 解码为 any 得到。
+func validateSchema(schema any, value any, path string) []string {
+	if path == "" {
+		path = "/"
+	}
+
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return []string{path + ": not allowed"}
+		}
+		return nil
+	case map[string]any:
+		return validateObjectSchema(s, value, path)
+	default:
+		return []string{path + ": invalid schema"}
+	}
+}
+
+// validateObjectSchema 校验对象形式的 schema
+func validateObjectSchema(schema map[string]any, value any, path string) []string {
+	var errs []string
+	fail := func(format string, args ...any) {
+		errs = append(errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		fail("expected %s, got %s", describeType(t), jsonType(value))
+		return errs
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value not in enum")
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, value) {
+		fail("value does not match const")
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, present := v[key]; !present {
+						fail("missing required property %q", key)
+					}
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := joinPointer(path, key)
+			if sub, ok := props[key]; ok {
+				errs = append(errs, validateSchema(sub, v[key], child)...)
+				continue
+			}
+			if additional, ok := schema["additionalProperties"]; ok {
+				if allowed, isBool := additional.(bool); isBool && !allowed {
+					fail("unexpected property %q", key)
+				} else if !isBool {
+					errs = append(errs, validateSchema(additional, v[key], child)...)
+				}
+			}
+		}
+
+	case []any:
+		if items, ok := schema["items"]; ok {
+			for i, item := range v {
+				errs = append(errs, validateSchema(items, item, joinPointer(path, fmt.Sprint(i)))...)
+			}
+		}
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			fail("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			fail("expected at most %v items, got %d", n, len(v))
+		}
+
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			fail("string shorter than %v", n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			fail("string longer than %v", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				fail("invalid pattern %q", pattern)
+			} else if !re.MatchString(v) {
+				fail("string does not match pattern %q", pattern)
+			}
+		}
+
+	case float64:
+		if n, ok := schemaNumber(schema, "minimum"); ok && v < n {
+			fail("%v is less than minimum %v", v, n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && v > n {
+			fail("%v is greater than maximum %v", v, n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMinimum"); ok && v <= n {
+			fail("%v is not greater than %v", v, n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMaximum"); ok && v >= n {
+			fail("%v is not less than %v", v, n)
+		}
+	}
+
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			errs = append(errs, validateSchema(sub, value, path)...)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if len(validateSchema(sub, value, path)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("value does not match any schema in anyOf")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matched := 0
+		for _, sub := range oneOf {
+			if len(validateSchema(sub, value, path)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("value matches %d schemas in oneOf, expected exactly 1", matched)
+		}
+	}
+	if not, ok := schema["not"]; ok && len(validateSchema(not, value, path)) == 0 {
+		fail("value must not match schema in not")
+	}
+
+	return errs
+}
+
+// matchesType 判断 value 是否符合 type（字符串或字符串数组）
+func matchesType(t any, value any) bool {
+	switch t := t.(type) {
+	case string:
+		return matchesTypeName(t, value)
+	case []any:
+		for _, name := range t {
+			if s, ok := name.(string); ok && matchesTypeName(s, value) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// matchesTypeName 判断 value 是否为指定的 JSON 类型
+func matchesTypeName(name string, value any) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonType(value) == name
+	}
+}
+
+// describeType 返回 type 关键字的描述
+func describeType(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, 0, len(list))
+		for _, name := range list {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+// jsonType 返回解码后的值对应的 JSON 类型名
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// schemaNumber 读取 schema 中的数值关键字
+func schemaNumber(schema map[string]any, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+// joinPointer 拼接 JSON Pointer 路径
+func joinPointer(path, token string) string {
+	token = strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+	if path == "/" {
+		return "/" + token
+	}
+	return path + "/" + token
+}
+
+// schemaKeywords validateSchema 实现的关键字，以及不影响校验结果的注解关键字
+var schemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true,
+	"properties": true, "required": true, "additionalProperties": true,
+	"items": true, "minItems": true, "maxItems": true,
+	"minLength": true, "maxLength": true, "pattern": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true,
+	// 注解
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// parseSchema 解析 schema，确保其是对象或布尔值，且只使用 validateSchema 支持的关键字
+func parseSchema(data json.RawMessage) (any, error) {
+	var schema any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	if err := checkSchema(schema, "/"); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// checkSchema 递归检查 schema 及其子 schema 的形式和关键字，path 为 schema 内的 JSON Pointer
+func checkSchema(schema any, path string) error {
+	obj, ok := schema.(map[string]any)
+	if !ok {
+		if _, isBool := schema.(bool); isBool {
+			return nil
+		}
+		return fmt.Errorf("schema %s: must be an object or boolean", path)
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !schemaKeywords[key] {
+			return fmt.Errorf("schema %s: keyword %q not supported", path, key)
+		}
+		child := joinPointer(path, key)
+		switch key {
+		case "properties":
+			props, ok := obj[key].(map[string]any)
+			if !ok {
+				return fmt.Errorf("schema %s: must be an object", child)
+			}
+			names := make([]string, 0, len(props))
+			for name := range props {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if err := checkSchema(props[name], joinPointer(child, name)); err != nil {
+					return err
+				}
+			}
+		case "items", "additionalProperties", "not":
+			if err := checkSchema(obj[key], child); err != nil {
+				return err
+			}
+		case "allOf", "anyOf", "oneOf":
+			subs, ok := obj[key].([]any)
+			if !ok {
+				return fmt.Errorf("schema %s: must be an array", child)
+			}
+			for i, sub := range subs {
+				if err := checkSchema(sub, joinPointer(child, fmt.Sprint(i))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
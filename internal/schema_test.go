@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		errs   []string // 期望的错误（按顺序），为空表示校验通过
+	}{
+		{"类型匹配", `{"type":"string"}`, `"ok"`, nil},
+		{"类型不匹配", `{"type":"string"}`, `1`, []string{"/: expected string, got number"}},
+		{"整数", `{"type":"integer"}`, `1.5`, []string{"/: expected integer, got number"}},
+		{"多个类型", `{"type":["string","null"]}`, `null`, nil},
+		{"缺少必填字段", `{"type":"object","required":["status","summary"]}`, `{"status":"PASS"}`,
+			[]string{`/: missing required property "summary"`}},
+		{"枚举", `{"enum":["PASS","FAIL"]}`, `"SKIP"`, []string{"/: value not in enum"}},
+		{"嵌套属性", `{"type":"object","properties":{"result":{"type":"object","properties":{"count":{"type":"integer","minimum":0}}}}}`,
+			`{"result":{"count":-1}}`, []string{"/result/count: -1 is less than minimum 0"}},
+		{"数组元素", `{"type":"array","items":{"type":"object","required":["file"],"properties":{"file":{"type":"string"}}}}`,
+			`[{"file":"a.go"},{"file":2},{}]`,
+			[]string{"/1/file: expected string, got number", `/2: missing required property "file"`}},
+		{"禁止额外属性", `{"type":"object","properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`,
+			[]string{`/: unexpected property "b"`}},
+		{"oneOf", `{"oneOf":[{"type":"string"},{"type":"number"}]}`, `true`,
+			[]string{"/: value matches 0 schemas in oneOf, expected exactly 1"}},
+		{"pattern", `{"type":"string","pattern":"^v[0-9]+$"}`, `"v1"`, nil},
+		{"注解关键字", `{"title":"结果","description":"说明","type":"boolean"}`, `true`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := parseSchema(json.RawMessage(tt.schema))
+			if err != nil {
+				t.Fatalf("parseSchema: %v", err)
+			}
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			errs := validateSchema(schema, value, "")
+			if strings.Join(errs, "\n") != strings.Join(tt.errs, "\n") {
+				t.Errorf("错误为 %q，期望 %q", errs, tt.errs)
+			}
+		})
+	}
+}
+
+func TestParseSchemaUnsupportedKeyword(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		err    string // 期望错误包含的文本，为空表示解析成功
+	}{
+		{"$ref", `{"$ref":"#/$defs/item"}`, `schema /: keyword "$ref" not supported`},
+		{"format", `{"type":"string","format":"email"}`, `keyword "format" not supported`},
+		{"嵌套在 properties 中", `{"properties":{"when":{"type":"string","format":"date-time"}}}`,
+			`schema /properties/when: keyword "format" not supported`},
+		{"嵌套在 items 中", `{"items":{"uniqueItems":true}}`, `schema /items: keyword "uniqueItems" not supported`},
+		{"嵌套在 anyOf 中", `{"anyOf":[{"type":"string"},{"multipleOf":2}]}`, `schema /anyOf/1: keyword "multipleOf" not supported`},
+		{"属性名与关键字同名", `{"properties":{"format":{"type":"string"}}}`, ""},
+		{"非对象 schema", `[1]`, "must be an object or boolean"},
+		{"布尔 schema", `true`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSchema(json.RawMessage(tt.schema))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("parseSchema: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("错误为 %v，期望包含 %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultSearchLimit 默认最多返回的搜索结果数量
+const defaultSearchLimit = 100
+
+// snippetContext 摘要中匹配位置前后保留的字符数
+const snippetContext = 60
+
+// SearchOptions 搜索条件，所有非空条件都满足的消息才算匹配
+//
+//	Text  - 在消息内容（tool 消息包括输入和返回值）中查找，默认不区分大小写的子串匹配
+//	Regex - 为 true 时 Text 作为正则表达式
+//	Tool  - 工具名，支持 * 通配（如 "mcp__*"），只匹配 tool 消息
+//	Path  - tool 输入中的文件路径；含通配符时按 glob 匹配（支持 **，相对模式匹配任意目录下的路径），否则按路径后缀匹配
+type SearchOptions struct {
+	Text        string
+	Regex       bool
+	Tool        string
+	Path        string
+	SessionID   string // 只搜索该会话
+	AllProjects bool   // 同时搜索 ~/.claude/projects 下所有 jsonl，而不仅是受管理的会话
+	Thinking    bool   // 是否搜索 thinking 块
+	Limit       int
+}
+
+// searchMatcher 编译后的搜索条件
+type searchMatcher struct {
+	opts   SearchOptions
+	textRe *regexp.Regexp
+	pathRe *regexp.Regexp
+}
+
+// searchTarget 一个待搜索的 jsonl 文件
+type searchTarget struct {
+	sessionID       string // 受管理会话的 ID，未受管理时为空
+	claudeSessionID string
+	path            string
+}
+
+// Search 在会话 jsonl 中搜索消息，按文件顺序返回匹配结果
+func (sm *SessionManager) Search(opts SearchOptions) ([]*SearchResult, error) {
+	if opts.Text == "" && opts.Tool == "" && opts.Path == "" {
+		return nil, fmt.Errorf("query, tool or path required: %w", ErrInvalidRequest)
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultSearchLimit
+	}
+
+	m := &searchMatcher{opts: opts}
+	if opts.Text != "" {
+		pattern := regexp.QuoteMeta(opts.Text)
+		if opts.Regex {
+			pattern = opts.Text
+		}
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		m.textRe = re
+	}
+	if strings.ContainsAny(opts.Path, "*?") {
+		glob := opts.Path
+		if !filepath.IsAbs(glob) {
+			glob = "**/" + glob
+		}
+		re, err := globToRegexp(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path pattern: %w", err)
+		}
+		m.pathRe = re
+	}
+
+	targets, err := sm.searchTargets(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*SearchResult
+	for _, target := range targets {
+		file, err := os.Open(target.path)
+		if err != nil {
+			continue
+		}
+		messages, _, err := readTranscript(file, 0, "")
+		file.Close()
+		if err != nil {
+			continue
+		}
+
+		for _, msg := range messages {
+			text, ok := m.match(msg)
+			if !ok {
+				continue
+			}
+			results = append(results, &SearchResult{
+				SessionID:       target.sessionID,
+				ClaudeSessionID: target.claudeSessionID,
+				UUID:            msg.UUID,
+				Type:            msg.Type,
+				ToolName:        msg.ToolName,
+				Timestamp:       msg.Timestamp,
+				Snippet:         text,
+			})
+			if len(results) >= opts.Limit {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// searchTargets 返回需要搜索的 jsonl 文件
+func (sm *SessionManager) searchTargets(opts SearchOptions) ([]*searchTarget, error) {
+	// claude session id -> 受管理会话 ID
+	managed := make(map[string]string)
+	if opts.SessionID != "" {
+		session, err := sm.GetSession(opts.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		managed[claudeIDOf(session)] = session.ID
+	} else {
+		for _, session := range sm.ListSessions() {
+			managed[claudeIDOf(session)] = session.ID
+		}
+	}
+
+	var targets []*searchTarget
+	if opts.AllProjects && opts.SessionID == "" {
+		paths, _ := filepath.Glob(filepath.Join(os.Getenv("HOME"), ".claude", "projects", "*", "*.jsonl"))
+		for _, p := range paths {
+			claudeID := strings.TrimSuffix(filepath.Base(p), ".jsonl")
+			targets = append(targets, &searchTarget{sessionID: managed[claudeID], claudeSessionID: claudeID, path: p})
+		}
+		sort.Slice(targets, func(i, j int) bool { return targets[i].path < targets[j].path })
+		return targets, nil
+	}
+
+	for claudeID, sessionID := range managed {
+		p, err := findTranscriptPath(claudeID)
+		if err != nil {
+			// 尚未对话的会话没有 jsonl 文件
+			continue
+		}
+		targets = append(targets, &searchTarget{sessionID: sessionID, claudeSessionID: claudeID, path: p})
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].sessionID < targets[j].sessionID })
+	return targets, nil
+}
+
+// match 判断消息是否满足所有条件，返回匹配处的摘要
+func (m *searchMatcher) match(msg *Message) (string, bool) {
+	if msg.Type == "thinking" && !m.opts.Thinking {
+		return "", false
+	}
+
+	if m.opts.Tool != "" {
+		if msg.Type != "tool" {
+			return "", false
+		}
+		if ok, _ := path.Match(m.opts.Tool, msg.ToolName); !ok {
+			return "", false
+		}
+	}
+
+	if m.opts.Path != "" {
+		if msg.Type != "tool" || !m.matchPath(toolInputPath(msg.Input)) {
+			return "", false
+		}
+	}
+
+	if m.textRe == nil {
+		return snippet(msg.Content, 0, 0), true
+	}
+
+	texts := []string{msg.Content}
+	if msg.Type == "tool" && msg.Result != nil {
+		texts = append(texts, msg.Result.Content)
+	}
+	for _, text := range texts {
+		if loc := m.textRe.FindStringIndex(text); loc != nil {
+			return snippet(text, loc[0], loc[1]), true
+		}
+	}
+	return "", false
+}
+
+// matchPath 判断文件路径是否匹配 Path 条件
+func (m *searchMatcher) matchPath(p string) bool {
+	if p == "" {
+		return false
+	}
+	if m.pathRe != nil {
+		return m.pathRe.MatchString(p)
+	}
+	want := filepath.Clean(m.opts.Path)
+	p = filepath.Clean(p)
+	return p == want || strings.HasSuffix(p, "/"+strings.TrimPrefix(want, "/"))
+}
+
+// snippet 截取 text 中 [start, end) 附近的内容，合并空白字符
+func snippet(text string, start, end int) string {
+	from := max(0, start-snippetContext)
+	to := min(len(text), end+snippetContext)
+	if end == 0 {
+		to = min(len(text), 2*snippetContext)
+	}
+	// 避免截断多字节字符
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+
+	result := strings.Join(strings.Fields(text[from:to]), " ")
+	if from > 0 {
+		result = "…" + result
+	}
+	if to < len(text) {
+		result += "…"
+	}
+	return result
+}
@@ -1,14 +1,18 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -22,20 +26,47 @@ type Server struct {
 	socketPath string
 	sessionMgr *SessionManager
 	httpServer *http.Server
+	tcpServer  *http.Server  // 可选的 TCP listener（StartTCP）
+	tokens     []*Token      // TCP 接口接受的 token
+	peerAccess PeerAccess    // Unix socket 的访问控制
+	audit      *AuditLog     // 审计日志，nil 表示不记录
+	redactor   *Redactor     // 输出脱敏，nil 表示不脱敏
+	quotas     *quotaTracker // 会话配额与速率限制
+	mux        *http.ServeMux
 	logger     *log.Logger
+	policy     *Policy // 全局自动授权规则
+	done       chan struct{}
 }
 
+// budgetCheckInterval 检查 token 预算的间隔
+const budgetCheckInterval = 5 * time.Second
+
 // NewServer 创建新的 Server
 func NewServer(socketPath string) *Server {
 	if socketPath == "" {
 		socketPath = SocketPath
 	}
 
-	return &Server{
+	s := &Server{
 		socketPath: socketPath,
 		sessionMgr: NewSessionManager(),
+		redactor:   DefaultRedactor(),
+		quotas:     newQuotaTracker(),
 		logger:     log.New(os.Stdout, "[claude-pty] ", log.LstdFlags),
+		done:       make(chan struct{}),
 	}
+	s.mux = s.routes()
+	return s
+}
+
+// SetPolicy 设置全局自动授权规则
+func (s *Server) SetPolicy(policy *Policy) {
+	s.policy = policy
+}
+
+// SetPricing 设置模型价格表（用于估算费用）
+func (s *Server) SetPricing(pricing map[string]ModelPrice) {
+	s.sessionMgr.SetPricing(pricing)
 }
 
 // Start 启动 Server
@@ -51,18 +82,21 @@ func (s *Server) Start() error {
 		return fmt.Errorf("listen on unix socket: %w", err)
 	}
 
-	// 设置 socket 权限
+	// 设置 socket 权限：任何用户都可以连接，是否允许由 PeerAccess 按对端 UID/GID 判断
 	if err := os.Chmod(s.socketPath, 0777); err != nil {
 		s.logger.Printf("warning: chmod socket: %v", err)
 	}
 
 	// 创建 HTTP 服务器
 	s.httpServer = &http.Server{
-		Handler: s,
+		Handler:     s,
+		ConnContext: unixConnContext,
 	}
 
 	s.logger.Printf("Server listening on %s", s.socketPath)
 
+	go s.monitorBudgets()
+
 	// 启动 HTTP 服务器
 	return s.httpServer.Serve(listener)
 }
@@ -80,72 +114,159 @@ func (s *Server) Stop() error {
 		}
 	}
 
+	close(s.done)
+
+	if s.audit != nil {
+		s.audit.Close()
+	}
+	if s.tcpServer != nil {
+		s.tcpServer.Close()
+	}
 	if s.httpServer != nil {
 		return s.httpServer.Close()
 	}
 	return nil
 }
 
-// ServeHTTP 处理 HTTP 请求
-func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// 只接受本地 socket 连接
-	if r.RemoteAddr != "@" && r.RemoteAddr != "" {
-		s.logger.Printf("rejecting request from %s", r.RemoteAddr)
-		http.Error(w, "forbidden", http.StatusForbidden)
-		return
+// monitorBudgets 定期检查运行中会话的 token 用量，超出预算时清空 prompt 队列并中断当前回合
+func (s *Server) monitorBudgets() {
+	ticker := time.NewTicker(budgetCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		for _, sessionID := range s.sessionMgr.overBudgetSessions() {
+			session, err := s.sessionMgr.GetSession(sessionID)
+			if err != nil {
+				continue
+			}
+			s.logger.Printf("Session %s exceeded token budget, interrupting", sessionID)
+
+			s.sessionMgr.ClearQueue(sessionID)
+			session.addHistory("budget_exceeded", "", fmt.Sprintf("budget %d tokens", session.TokenBudget))
+			if _, err := s.sessionMgr.InterruptSession(sessionID, false, 10*time.Second); err != nil {
+				s.logger.Printf("interrupt session %s: %v", sessionID, err)
+			}
+		}
 	}
+}
 
+// ServeHTTP 处理 HTTP 请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// 设置响应头
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(APIVersionHeader, strconv.Itoa(APIVersion))
+
+	// 认证：Unix socket 连接拥有全部权限，TCP 连接需要 token；具体 action 的权限在 dispatch 中检查
+	caller, err := s.authenticate(r)
+	if err != nil {
+		s.logger.Printf("rejecting request from %s: %v", r.RemoteAddr, err)
+		if errors.Is(err, ErrUnauthorized) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="claude-pty"`)
+		}
+		s.writeREST(w, errorResponse(err), http.StatusOK)
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), callerKey{}, caller))
 
-	switch r.URL.Path {
-	case "/":
-		s.handleRequest(w, r)
-	case "/list":
-		s.handleList(w, r)
-	default:
-		s.sendError(w, http.StatusNotFound, "not found")
+	// 版本协商：客户端声明的版本不受支持时直接拒绝（/version 除外，便于客户端查询支持的范围）
+	if _, ok := parseVersionHeader(r.Header.Get(APIVersionHeader)); !ok && r.URL.Path != "/version" {
+		s.writeREST(w, versionError(r.Header.Get(APIVersionHeader)), http.StatusOK)
+		return
 	}
+
+	s.mux.ServeHTTP(w, r)
 }
 
 // handleRequest 处理请求
 func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	body, err := s.readBody(w, r)
 	if err != nil {
-		s.sendError(w, http.StatusBadRequest, "read request body")
+		s.sendBodyError(w, err)
 		return
 	}
 
 	var req Request
 	if err := json.Unmarshal(body, &req); err != nil {
-		s.sendError(w, http.StatusBadRequest, "parse JSON")
+		s.sendError(w, http.StatusBadRequest, CodeInvalidRequest, "parse JSON")
 		return
 	}
+	req.caller = callerFrom(r.Context())
+
+	s.sendResponse(w, s.dispatch(req))
+}
+
+// actionSpec 一个 action 的处理函数、所需权限和说明（说明用于 OpenAPI 文档）
+type actionSpec struct {
+	handle  func(*Server, Request) Response
+	scope   Scope
+	summary string
+}
+
+// actions 所有 action，旧的 action 接口和 REST 路由共用
+var actions = map[string]actionSpec{
+	"create":             {(*Server).handleCreate, ScopeInput, "Create a session"},
+	"delete":             {(*Server).handleDelete, ScopeAdmin, "Delete a session"},
+	"get":                {(*Server).handleGet, ScopeRead, "Read terminal output (limit_str: N lines, >N turns, .N blocks)"},
+	"input":              {(*Server).handleInput, ScopeInput, "Send raw text or structured input items"},
+	"submit":             {(*Server).handleSubmit, ScopeInput, "Paste a prompt and press Enter"},
+	"interrupt":          {(*Server).handleInterrupt, ScopeInput, "Interrupt the current turn"},
+	"respond_permission": {(*Server).handleRespondPermission, ScopeInput, "Answer a pending permission prompt (allow or deny)"},
+	"enqueue":            {(*Server).handleEnqueue, ScopeInput, "Queue a prompt for when the session stops"},
+	"queue":              {(*Server).handleQueue, ScopeRead, "Show queued prompts"},
+	"clear_queue":        {(*Server).handleClearQueue, ScopeInput, "Clear queued prompts"},
+	"set_status":         {(*Server).handleSetStatus, ScopeAdmin, "Set session status (used by hooks)"},
+	"get_status":         {(*Server).handleGetStatus, ScopeRead, "Get session status"},
+	"get_info":           {(*Server).handleGetInfo, ScopeRead, "Get session information"},
+	"messages":           {(*Server).handleMessages, ScopeRead, "Read conversation messages"},
+	"export":             {(*Server).handleExport, ScopeRead, "Export the transcript as Markdown or HTML"},
+	"search":             {(*Server).handleSearch, ScopeRead, "Search transcripts across sessions"},
+	"changes":            {(*Server).handleChanges, ScopeRead, "List files changed by the agent"},
+	"todos":              {(*Server).handleTodos, ScopeRead, "Get Claude's todo list"},
+	"subagent":           {(*Server).handleSubagent, ScopeAdmin, "Record a subagent start or stop (used by hooks)"},
+	"result":             {(*Server).handleResult, ScopeRead, "Get the final answer of the last turn, optionally as validated JSON"},
+	"set_policy":         {(*Server).handleSetPolicy, ScopeAdmin, "Set the session permission policy"},
+	"set_budget":         {(*Server).handleSetBudget, ScopeAdmin, "Set the session token budget"},
+	"audit":              {(*Server).handleAudit, ScopeAdmin, "Query the audit log (session_id, since, limit)"},
+	"quotas":             {(*Server).handleQuotas, ScopeAdmin, "Show session quotas, rate limits and current usage"},
+}
 
+// dispatch 按 action 调用对应的处理函数
+func (s *Server) dispatch(req Request) Response {
+	if !supportedVersion(req.APIVersion) {
+		return versionError(strconv.Itoa(req.APIVersion))
+	}
+
+	action, ok := actions[req.Action]
+	if !ok {
+		return errorResponse(fmt.Errorf("%w: %s", ErrUnknownAction, req.Action))
+	}
 	var resp Response
+	err := s.authorize(req.caller, req.Action, action.scope, req.SessionID)
+	if err == nil && req.Raw {
+		err = s.authorize(req.caller, "raw output", ScopeAdmin, "")
+	}
+	if err == nil && req.AllProjects {
+		// 会读取 daemon 用户所有不受管理的会话记录
+		err = s.authorize(req.caller, "search all_projects", ScopeAdmin, "")
+	}
+	if err != nil {
+		resp = errorResponse(err)
+	} else {
+		resp = action.handle(s, req)
+		resp.raw = req.Raw
+	}
 
-	switch req.Action {
-	case "create":
-		resp = s.handleCreate(req)
-	case "delete":
-		resp = s.handleDelete(req)
-	case "get":
-		resp = s.handleGet(req)
-	case "input":
-		resp = s.handleInput(req)
-	case "set_status":
-		resp = s.handleSetStatus(req)
-	case "get_status":
-		resp = s.handleGetStatus(req)
-	case "get_info":
-		resp = s.handleGetInfo(req)
-	case "messages":
-		resp = s.handleMessages(req)
-	default:
-		resp = Response{Success: false, Error: "unknown action: " + req.Action}
-	}
-
-	s.sendResponse(w, resp)
+	// 修改状态的调用、未脱敏的读取和跨项目搜索（包括被拒绝的）写入审计日志
+	if action.scope != ScopeRead || req.Raw || req.AllProjects {
+		s.recordAudit(req, resp)
+	}
+	return resp
 }
 
 // handleCreate 处理创建会话请求
@@ -160,10 +281,40 @@ func (s *Server) handleCreate(req Request) Response {
 		return Response{Success: false, Error: "cwd not found: " + err.Error()}
 	}
 
+	if req.Policy != nil {
+		// 自动授权规则与 set_policy 一样需要 admin 权限（本地用户是新会话的创建者，可以设置）
+		if req.caller != nil && req.caller.UID < 0 {
+			if err := s.authorize(req.caller, "create with policy", ScopeAdmin, ""); err != nil {
+				return errorResponse(err)
+			}
+		}
+		if err := req.Policy.Compile(); err != nil {
+			return Response{Success: false, Error: "invalid policy: " + err.Error()}
+		}
+	}
+
+	release, err := s.reserveSession(req.caller)
+	if err != nil {
+		return errorResponse(err)
+	}
+	defer release()
+
 	sessionID := uuid.New().String()
-	session, err := s.sessionMgr.CreateSession(sessionID, cwd)
+	session, err := s.sessionMgr.CreateSession(sessionID, cwd, func(session *Session) {
+		// 会话出现在列表中的同时记录创建者并释放占用的名额，配额统计不会重复或遗漏
+		if req.caller != nil {
+			session.setOwner(req.caller)
+		}
+		release()
+	})
 	if err != nil {
-		return Response{Success: false, Error: err.Error()}
+		return errorResponse(err)
+	}
+	if req.Policy != nil {
+		s.sessionMgr.SetPolicy(sessionID, req.Policy)
+	}
+	if req.Budget > 0 {
+		s.sessionMgr.SetTokenBudget(sessionID, req.Budget)
 	}
 
 	return Response{
@@ -180,7 +331,7 @@ func (s *Server) handleDelete(req Request) Response {
 
 	err := s.sessionMgr.DeleteSession(req.SessionID)
 	if err != nil {
-		return Response{Success: false, Error: err.Error()}
+		return errorResponse(err)
 	}
 
 	return Response{Success: true}
@@ -194,34 +345,168 @@ func (s *Server) handleGet(req Request) Response {
 
 	output, err := s.sessionMgr.ReadFromSession(req.SessionID, req.LimitStr)
 	if err != nil {
-		return Response{Success: false, Error: err.Error()}
+		return errorResponse(err)
 	}
 
 	return Response{Success: true, Output: output}
 }
 
-// handleInput 处理发送输入请求
+// handleInput 处理发送输入请求。
+// items 为结构化输入（字面文本与按键明确区分）；text 为旧格式，直接传给 tmux send-keys。
 func (s *Server) handleInput(req Request) Response {
 	if req.SessionID == "" {
 		return Response{Success: false, Error: "session_id required"}
 	}
-	if req.Text == "" {
-		return Response{Success: false, Error: "text required"}
+	if req.Text == "" && len(req.Items) == 0 {
+		return Response{Success: false, Error: "text or items required"}
+	}
+	if err := validateInputItems(req.Items); err != nil {
+		return Response{Success: false, Error: "invalid items: " + err.Error()}
+	}
+	if err := s.checkInputSize(req); err != nil {
+		return errorResponse(err)
 	}
 
 	// 如果当前状态为 need_permission 且输入为 Enter，则将状态改为 running
-	if status, err := s.sessionMgr.GetStatus(req.SessionID); err == nil && status == "need_permission" && req.Text == "Enter" {
+	if status, err := s.sessionMgr.GetStatus(req.SessionID); err == nil && status == "need_permission" && pressesEnter(req) {
 		s.sessionMgr.SetStatus(req.SessionID, "running")
 	}
 
-	_, err := s.sessionMgr.WriteToSession(req.SessionID, req.Text)
+	var err error
+	if len(req.Items) > 0 {
+		err = s.sessionMgr.SendInput(req.SessionID, req.Items)
+	} else {
+		_, err = s.sessionMgr.WriteToSession(req.SessionID, req.Text)
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return Response{Success: true}
+}
+
+// pressesEnter 判断输入是否包含 Enter 按键
+func pressesEnter(req Request) bool {
+	if len(req.Items) == 0 {
+		return req.Text == "Enter"
+	}
+	for _, item := range req.Items {
+		if item.Key == "Enter" {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSubmit 处理提交 prompt 请求（粘贴文本并按 Enter）
+func (s *Server) handleSubmit(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+	if req.Text == "" {
+		return Response{Success: false, Error: "text required"}
+	}
+	if err := s.checkInputSize(req); err != nil {
+		return errorResponse(err)
+	}
+
+	status, err := s.sessionMgr.SubmitToSession(req.SessionID, req.Text, requestTimeout(req, 5*time.Second))
 	if err != nil {
-		return Response{Success: false, Error: err.Error()}
+		resp := errorResponse(err)
+		resp.Status = status
+		return resp
+	}
+
+	return Response{Success: true, Status: status}
+}
+
+// handleInterrupt 处理中断当前回合请求
+func (s *Server) handleInterrupt(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+
+	status, err := s.sessionMgr.InterruptSession(req.SessionID, req.Force, requestTimeout(req, 10*time.Second))
+	if err != nil {
+		resp := errorResponse(err)
+		resp.Status = status
+		return resp
+	}
+
+	return Response{Success: true, Status: status}
+}
+
+// handleRespondPermission 处理回应权限对话框请求：按键和状态更新在服务端一次完成
+func (s *Server) handleRespondPermission(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+
+	status, err := s.sessionMgr.RespondPermission(req.SessionID, req.Decision)
+	if err != nil {
+		resp := errorResponse(err)
+		resp.Status = status
+		return resp
+	}
+
+	return Response{Success: true, Status: status}
+}
+
+// handleEnqueue 处理加入 prompt 队列请求，会话变为 stopped 时自动提交
+func (s *Server) handleEnqueue(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+	if req.Text == "" {
+		return Response{Success: false, Error: "text required"}
+	}
+	if err := s.checkInputSize(req); err != nil {
+		return errorResponse(err)
+	}
+
+	queue, err := s.sessionMgr.Enqueue(req.SessionID, req.Text)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return Response{Success: true, Queue: queue}
+}
+
+// handleQueue 处理查看 prompt 队列请求
+func (s *Server) handleQueue(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+
+	queue, err := s.sessionMgr.GetQueue(req.SessionID)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return Response{Success: true, Queue: queue}
+}
+
+// handleClearQueue 处理清空 prompt 队列请求
+func (s *Server) handleClearQueue(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+
+	if _, err := s.sessionMgr.ClearQueue(req.SessionID); err != nil {
+		return errorResponse(err)
 	}
 
 	return Response{Success: true}
 }
 
+// requestTimeout 返回请求指定的超时，未指定时使用默认值
+func requestTimeout(req Request, def time.Duration) time.Duration {
+	if req.Timeout > 0 {
+		return time.Duration(req.Timeout) * time.Second
+	}
+	return def
+}
+
 // handleSetStatus 处理设置状态请求
 func (s *Server) handleSetStatus(req Request) Response {
 	if req.SessionID == "" {
@@ -230,11 +515,66 @@ func (s *Server) handleSetStatus(req Request) Response {
 
 	err := s.sessionMgr.SetStatus(req.SessionID, req.Status)
 	if err != nil {
-		return Response{Success: false, Error: err.Error()}
+		return errorResponse(err)
 	}
 
 	fmt.Printf("Session %s status updated: status=%s\n", req.SessionID, req.Status)
 
+	if req.Status == "need_permission" && len(req.Hook) > 0 {
+		s.evaluatePermission(req.SessionID, req.Hook)
+	}
+
+	return Response{Success: true}
+}
+
+// evaluatePermission 根据会话级和全局规则自动处理权限请求，没有命中规则时留给人工处理
+func (s *Server) evaluatePermission(sessionID string, hook []byte) {
+	var event HookEvent
+	if err := json.Unmarshal(hook, &event); err != nil {
+		s.logger.Printf("parse hook event: %v", err)
+		return
+	}
+
+	session, err := s.sessionMgr.GetSession(sessionID)
+	if err != nil {
+		return
+	}
+	session.mu.Lock()
+	policy, cwd := session.Policy, session.CWD
+	session.mu.Unlock()
+
+	// 会话级规则的 allow 不能覆盖全局规则的 deny
+	rule := evaluatePolicies(&event, cwd, policy, s.policy)
+	if rule == nil {
+		return
+	}
+
+	s.logger.Printf("Session %s policy %s: %s %s", sessionID, rule.Decision, event.ToolName, s.redactor.Redact(describeHookEvent(&event), nil))
+	s.recordPolicyAudit(sessionID, rule, &event, hook)
+
+	// hook 需要尽快返回，对话框才会出现，因此异步发送按键
+	go func() {
+		if err := s.sessionMgr.ApplyPermissionDecision(sessionID, rule, &event); err != nil {
+			s.logger.Printf("apply policy decision for %s: %v", sessionID, err)
+		}
+	}()
+}
+
+// handleSetPolicy 处理设置会话级自动授权规则请求
+func (s *Server) handleSetPolicy(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+	if req.Policy != nil {
+		if err := req.Policy.Compile(); err != nil {
+			return Response{Success: false, Error: "invalid policy: " + err.Error()}
+		}
+	}
+
+	if err := s.sessionMgr.SetPolicy(req.SessionID, req.Policy); err != nil {
+		return errorResponse(err)
+	}
+
 	return Response{Success: true}
 }
 
@@ -246,7 +586,7 @@ func (s *Server) handleGetStatus(req Request) Response {
 
 	status, err := s.sessionMgr.GetStatus(req.SessionID)
 	if err != nil {
-		return Response{Success: false, Error: err.Error()}
+		return errorResponse(err)
 	}
 
 	return Response{Success: true, Status: status}
@@ -260,10 +600,33 @@ func (s *Server) handleGetInfo(req Request) Response {
 
 	session, err := s.sessionMgr.GetSession(req.SessionID)
 	if err != nil {
-		return Response{Success: false, Error: err.Error()}
+		return errorResponse(err)
 	}
 
-	return Response{Success: true, Session: session.ToSessionInfo()}
+	// 会话文件可能还不存在（尚未对话），忽略错误
+	s.sessionMgr.RefreshUsage(req.SessionID)
+
+	info := session.ToSessionInfo()
+	if todos, err := s.sessionMgr.GetTodos(req.SessionID); err == nil {
+		info.Todos = todos
+	}
+	return Response{Success: true, Session: info}
+}
+
+// handleSetBudget 处理设置会话 token 预算请求（token_budget 为 0 表示取消限制）
+func (s *Server) handleSetBudget(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+	if req.Budget < 0 {
+		return Response{Success: false, Error: "token_budget must not be negative"}
+	}
+
+	if err := s.sessionMgr.SetTokenBudget(req.SessionID, req.Budget); err != nil {
+		return errorResponse(err)
+	}
+
+	return Response{Success: true}
 }
 
 // handleMessages 处理获取消息历史请求
@@ -272,45 +635,274 @@ func (s *Server) handleMessages(req Request) Response {
 		return Response{Success: false, Error: "session_id required"}
 	}
 
-	messages, err := s.sessionMgr.GetMessages(req.SessionID, req.Limit)
+	if req.Tree {
+		messages, err := s.sessionMgr.GetMessageTree(req.SessionID, req.Limit, req.Thinking)
+		if err != nil {
+			return errorResponse(err)
+		}
+		return Response{Success: true, Messages: messages}
+	}
+
+	messages, next, err := s.sessionMgr.GetMessages(req.SessionID, req.Limit, req.Cursor, req.Thinking)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return Response{Success: true, Messages: messages, NextCursor: next}
+}
+
+// handleExport 处理导出请求，渲染结果放在 output 中
+func (s *Server) handleExport(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+
+	output, err := s.sessionMgr.ExportTranscript(req.SessionID, req.Format, req.Thinking)
 	if err != nil {
-		return Response{Success: false, Error: err.Error()}
+		return errorResponse(err)
 	}
 
-	return Response{Success: true, Messages: messages}
+	return Response{Success: true, Output: output}
+}
+
+// handleSearch 处理跨会话搜索请求（session_id 为空时搜索所有会话）
+func (s *Server) handleSearch(req Request) Response {
+	results, err := s.sessionMgr.Search(SearchOptions{
+		Text:        req.Query,
+		Regex:       req.Regex,
+		Tool:        req.Tool,
+		Path:        req.Path,
+		SessionID:   req.SessionID,
+		AllProjects: req.AllProjects,
+		Thinking:    req.Thinking,
+		Limit:       req.Limit,
+	})
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return Response{Success: true, Results: results}
+}
+
+// handleChanges 处理文件改动汇总请求（path 只返回单个文件，diff 为 true 时包含 unified diff）
+func (s *Server) handleChanges(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+
+	changes, err := s.sessionMgr.GetChanges(req.SessionID, req.Diff, req.Path)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return Response{Success: true, Changes: changes}
+}
+
+// handleTodos 处理获取 todo 列表请求
+func (s *Server) handleTodos(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+
+	todos, err := s.sessionMgr.GetTodos(req.SessionID)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return Response{Success: true, Todos: todos}
+}
+
+// handleSubagent 处理 hook 发送的 subagent 启动（status=start）或结束（status=stop）通知
+func (s *Server) handleSubagent(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+	if req.Status != "start" && req.Status != "stop" {
+		return Response{Success: false, Error: "status must be start or stop"}
+	}
+
+	var event *HookEvent
+	if len(req.Hook) > 0 {
+		event = &HookEvent{}
+		if err := json.Unmarshal(req.Hook, event); err != nil {
+			return Response{Success: false, Error: "parse hook: " + err.Error()}
+		}
+	}
+
+	active, err := s.sessionMgr.SubagentEvent(req.SessionID, req.Status == "start", event)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	fmt.Printf("Session %s subagent %s: active=%d\n", req.SessionID, req.Status, active)
+	return Response{Success: true}
+}
+
+// handleResult 返回最近一个回合的最终回复（output）；json 或 schema 指定时提取其中的 JSON（result）并校验
+func (s *Server) handleResult(req Request) Response {
+	if req.SessionID == "" {
+		return Response{Success: false, Error: "session_id required"}
+	}
+
+	msg, err := s.sessionMgr.GetResult(req.SessionID)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if !req.JSON && len(req.Schema) == 0 {
+		return Response{Success: true, Output: msg.Content}
+	}
+
+	result, invalid, err := ExtractResult(msg.Content, req.Schema)
+	if err != nil {
+		resp := errorResponse(err)
+		resp.Output = msg.Content
+		return resp
+	}
+	if len(invalid) > 0 {
+		return Response{
+			Success:          false,
+			Error:            fmt.Sprintf("%v: %s", ErrSchemaValidation, strings.Join(invalid, "; ")),
+			err:              ErrSchemaValidation,
+			Output:           msg.Content,
+			Result:           result,
+			ValidationErrors: invalid,
+		}
+	}
+
+	return Response{Success: true, Output: msg.Content, Result: result}
+}
+
+// handleEvents 以 NDJSON 流推送会话事件（?session_id= 或 /sessions/{id}/events 只订阅单个会话），直到客户端断开
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	if sessionID == "" {
+		sessionID = r.URL.Query().Get("session_id")
+	}
+	if sessionID != "" {
+		if _, err := s.sessionMgr.GetSession(sessionID); err != nil {
+			s.writeREST(w, errorResponse(err), http.StatusOK)
+			return
+		}
+	}
+	var req Request
+	if err := parseQuery(r.URL.Query(), &req); err != nil {
+		s.sendError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	if req.Raw {
+		// 与 dispatch 一样，未脱敏的读取需要 admin 权限并写入审计日志
+		req.Action, req.SessionID, req.caller = "events", sessionID, callerFrom(r.Context())
+		if err := s.authorize(req.caller, "raw output", ScopeAdmin, ""); err != nil {
+			resp := errorResponse(err)
+			s.recordAudit(req, resp)
+			s.writeREST(w, resp, http.StatusOK)
+			return
+		}
+		s.recordAudit(req, Response{Success: true})
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.sendError(w, http.StatusInternalServerError, CodeInternal, "streaming not supported")
+		return
+	}
+
+	events, cancel := s.sessionMgr.Subscribe(sessionID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err == nil && !req.Raw {
+				data, err = s.redactor.redactJSON(data)
+			}
+			if err != nil {
+				s.logger.Printf("encode event: %v", err)
+				return
+			}
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
 }
 
 // handleList 处理列表请求
 func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.sendResponse(w, s.listSessions())
+}
+
+// listSessions 返回所有会话的信息
+func (s *Server) listSessions() Response {
 	sessions := s.sessionMgr.ListSessions()
 
 	sessionInfos := make([]*SessionInfo, len(sessions))
-	for i, s := range sessions {
-		sessionInfos[i] = s.ToSessionInfo()
+	for i, session := range sessions {
+		s.sessionMgr.RefreshUsage(session.ID)
+		sessionInfos[i] = session.ToSessionInfo()
 	}
 
-	resp := Response{
+	return Response{
 		Success:  true,
 		Sessions: sessionInfos,
 	}
+}
 
-	s.sendResponse(w, resp)
+// errorResponse 创建失败响应，保留原始错误用于确定 HTTP 状态码
+func errorResponse(err error) Response {
+	return Response{Success: false, Error: err.Error(), err: err}
 }
 
+// versionError 创建客户端 API 版本不受支持的失败响应
+func versionError(version string) Response {
+	return errorResponse(fmt.Errorf("%w %q (server supports %d-%d)", ErrUnsupportedVersion, version, MinAPIVersion, APIVersion))
+}
+
+// handleVersion 返回服务端支持的 API 版本范围，不做版本检查，供客户端协商
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.sendResponse(w, Response{Success: true, MinAPIVersion: MinAPIVersion})
+}
+
+// sendResponse 写入响应，填充 API 版本和失败时的错误码
 func (s *Server) sendResponse(w http.ResponseWriter, resp Response) {
+	resp.APIVersion = APIVersion
+	if !resp.Success && resp.Code == "" {
+		resp.Code = errorCode(resp)
+	}
 	data, err := json.Marshal(resp)
 	if err != nil {
 		s.logger.Printf("marshal response: %v", err)
 		return
 	}
+	if !resp.raw {
+		if data, err = s.redactor.redactJSON(data); err != nil {
+			s.logger.Printf("redact response: %v", err)
+			return
+		}
+	}
 
 	w.Write(data)
 }
 
-func (s *Server) sendError(w http.ResponseWriter, code int, msg string) {
-	resp := Response{Success: false, Error: msg}
+func (s *Server) sendError(w http.ResponseWriter, status int, code ErrorCode, msg string) {
+	resp := Response{Success: false, Error: msg, Code: code, APIVersion: APIVersion}
 	data, _ := json.Marshal(resp)
-	http.Error(w, string(data), code)
+	// 不使用 http.Error：它会把 Content-Type 改为 text/plain
+	w.WriteHeader(status)
+	w.Write(data)
 }
 
 // getSocketDir 获取 socket 文件所在的目录
@@ -1,10 +1,9 @@
 package internal
 
 import (
-	"bufio"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -24,12 +23,104 @@ type Session struct {
 	Status          string // running, stopped, need_permission
 	CreatedAt       time.Time
 	LastActivity    time.Time
+	Policy          *Policy         // 会话级自动授权规则（优先于全局规则）
+	History         []*HistoryEntry // 自动授权决策等事件记录
+	statusChanged   chan struct{}   // 状态变化时关闭，用于等待 hook 通知
+	Queue           []string        // 待提交的 prompt（FIFO）
+	dispatching     bool            // 正在从队列提交 prompt
+	queuePaused     bool            // 中断、拒绝授权或连续提交失败后暂停自动提交，直到新回合开始或再次入队
+	queueFailures   int             // 队首 prompt 连续提交失败的次数
+	TokenBudget     int64           // token 预算，超出时自动中断，0 表示不限制
+	lastUsage       *UsageReport    // 最近一次统计的用量
+	usage           *usageTracker
+	usageMu         sync.Mutex // 保护 usage（读取文件期间不持有 mu）
+	todos           *TodoList  // Claude 当前的 todo 列表（由 watcher 更新）
+	ActiveSubagents int        // 正在运行的 subagent 数量（由 hook 更新）
+	OwnerUID        int        // 创建者的 UID，-1 表示未知（如通过 TCP 创建）
+	Creator         string     // 创建者的配额标识（uid:<uid> 或 token:<name>）
+	watcher         *transcriptWatcher
 	mu              sync.Mutex
+	inputMu         sync.Mutex // 串行化发往终端的按键，可以跨越 tmux 调用和等待持有（不持有 mu）
+}
+
+// setStatusLocked 修改状态并唤醒等待者，调用方需持有 s.mu。返回状态是否发生变化
+func (s *Session) setStatusLocked(status string) bool {
+	if status == s.Status {
+		return false
+	}
+	s.Status = status
+	if s.statusChanged != nil {
+		close(s.statusChanged)
+		s.statusChanged = nil
+	}
+	return true
+}
+
+// statusWatch 返回当前状态以及在下次状态变化时关闭的 channel
+func (s *Session) statusWatch() (string, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.statusChanged == nil {
+		s.statusChanged = make(chan struct{})
+	}
+	return s.Status, s.statusChanged
+}
+
+// touch 更新最后活动时间
+func (s *Session) touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastActivity = time.Now()
+}
+
+// setOwner 记录创建者
+func (s *Session) setOwner(caller *Caller) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.OwnerUID = caller.UID
+	s.Creator = caller.quotaKey()
+}
+
+// creator 返回创建者的配额标识，未知时为空
+func (s *Session) creator() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Creator
+}
+
+// ownerUID 返回创建者的 UID，-1 表示未知
+func (s *Session) ownerUID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.OwnerUID
+}
+
+// maxHistoryEntries 每个会话最多保留的历史记录数
+const maxHistoryEntries = 200
+
+// addHistory 追加一条历史记录
+func (s *Session) addHistory(event, tool, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.History = append(s.History, &HistoryEntry{
+		Time:   time.Now().Format("2006-01-02 15:04:05"),
+		Event:  event,
+		Tool:   tool,
+		Detail: detail,
+	})
+	if len(s.History) > maxHistoryEntries {
+		s.History = s.History[len(s.History)-maxHistoryEntries:]
+	}
 }
 
 // SessionManager 管理所有会话
 type SessionManager struct {
 	sessions map[string]*Session
+	pricing  map[string]ModelPrice // 模型价格表，用于估算费用
+	events   *eventBus
+	logger   *log.Logger
 	mu       sync.RWMutex
 }
 
@@ -37,6 +128,9 @@ type SessionManager struct {
 func NewSessionManager() *SessionManager {
 	return &SessionManager{
 		sessions: make(map[string]*Session),
+		pricing:  defaultPricing,
+		events:   newEventBus(),
+		logger:   log.New(os.Stdout, "[claude-pty] ", log.LstdFlags),
 	}
 }
 
@@ -60,7 +154,7 @@ func findClaudeBinary() (string, error) {
 		}
 	}
 
-	return "", errors.New("claude command not found in PATH")
+	return "", ErrClaudeNotFound
 }
 
 // tmuxCmd 创建一个使用独立 socket 的 tmux 命令
@@ -75,13 +169,14 @@ func runTmuxCommand(args ...string) error {
 	cmd := tmuxCmd(args...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("tmux %v: %w: %s", args, err, string(out))
+		return fmt.Errorf("%w: tmux %v: %w: %s", ErrTmuxFailed, args, err, string(out))
 	}
 	return nil
 }
 
-// CreateSession 创建一个新的 Claude Code 会话（使用 tmux）
-func (sm *SessionManager) CreateSession(sessionID, cwd string) (*Session, error) {
+// CreateSession 创建一个新的 Claude Code 会话（使用 tmux）。
+// onRegister 不为 nil 时在会话加入列表的同时调用（持有 sm.mu），用于设置创建者等需要和注册原子完成的操作
+func (sm *SessionManager) CreateSession(sessionID, cwd string, onRegister func(*Session)) (*Session, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -167,9 +262,14 @@ func (sm *SessionManager) CreateSession(sessionID, cwd string) (*Session, error)
 		Status:          "stopped",
 		CreatedAt:       time.Now(),
 		LastActivity:    time.Now(),
+		OwnerUID:        -1,
 	}
 
 	sm.sessions[sessionID] = session
+	if onRegister != nil {
+		onRegister(session)
+	}
+	sm.startWatcher(session)
 	return session, nil
 }
 
@@ -198,6 +298,10 @@ func (sm *SessionManager) DeleteSession(sessionID string) error {
 	// 使用 tmux kill-session 删除 tmux 会话
 	runTmuxCommand("kill-session", "-t", session.TmuxSessionName)
 
+	if session.watcher != nil {
+		session.watcher.close()
+	}
+
 	delete(sm.sessions, sessionID)
 	return nil
 }
@@ -226,13 +330,59 @@ func (sm *SessionManager) SetStatus(sessionID string, status string) error {
 
 	session.mu.Lock()
 	defer session.mu.Unlock()
-	if status != "" {
-		session.Status = status
+	if status != "" && session.setStatusLocked(status) {
+		sm.events.publish(&Event{Type: "status", SessionID: sessionID, Status: status})
+		switch status {
+		case "running":
+			// 新回合开始（例如用户手动提交），恢复被暂停的队列
+			session.queuePaused = false
+		case "stopped":
+			// subagent 不会在回合结束后继续运行
+			session.ActiveSubagents = 0
+			// Claude 回到空闲，提交队列中的下一个 prompt（中断或拒绝授权导致的停止不提交）
+			sm.dispatchQueueLocked(session)
+		}
 	}
 	session.LastActivity = time.Now()
 	return nil
 }
 
+// WaitForStatus 等待会话状态满足 done，超时返回 ErrTimeout 和当时的状态
+func (sm *SessionManager) WaitForStatus(sessionID string, done func(string) bool, timeout time.Duration) (string, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		status, changed := session.statusWatch()
+		if done(status) {
+			return status, nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return status, ErrTimeout
+		}
+	}
+}
+
+// SetPolicy 设置会话级自动授权规则，nil 表示清除
+func (sm *SessionManager) SetPolicy(sessionID string, policy *Policy) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.Policy = policy
+	return nil
+}
+
 // GetStatus 获取会话状态
 func (sm *SessionManager) GetStatus(sessionID string) (string, error) {
 	sm.mu.RLock()
@@ -248,153 +398,200 @@ func (sm *SessionManager) GetStatus(sessionID string) (string, error) {
 	return session.Status, nil
 }
 
-// GetMessages 获取会话消息历史
-func (sm *SessionManager) GetMessages(sessionID string, limit int) ([]*Message, error) {
+// WriteToSession 向会话发送输入
+func (sm *SessionManager) WriteToSession(sessionID, text string) (int, error) {
 	sm.mu.RLock()
 	session, ok := sm.sessions[sessionID]
 	sm.mu.RUnlock()
 
 	if !ok {
-		return nil, ErrSessionNotFound
+		return 0, ErrSessionNotFound
 	}
 
-	realSessionID := session.ClaudeSessionID
-	if realSessionID == "" {
-		realSessionID = sessionID
+	session.inputMu.Lock()
+	defer session.inputMu.Unlock()
+
+	// 使用 tmux send-keys 发送输入
+	err := runTmuxCommand("send-keys", "-t", session.TmuxSessionName, "--", text)
+	if err != nil {
+		return 0, err
 	}
 
-	// 查找 jsonl 文件
-	home := os.Getenv("HOME")
-	projectsDir := filepath.Join(home, ".claude", "projects")
+	// 发送换行符（如果文本中没有换行）
+	// if text[len(text)-1] != '\n' {
+	// 	err = runTmuxCommand("send-keys", "-t", session.TmuxSessionName, "Enter")
+	// 	if err != nil {
+	// 		return 0, err
+	// 	}
+	// }
+
+	session.touch()
 
-	var jsonlPath string
-	entries, _ := os.ReadDir(projectsDir)
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+	return len(text), nil
+}
+
+// SendInput 按顺序发送输入项：text 使用 send-keys -l 作为字面文本发送，key 作为按键发送，
+// delay_ms 在该项发送后等待。等待期间只持有 inputMu，不影响状态更新和查询。
+func (sm *SessionManager) SendInput(sessionID string, items []*InputItem) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session.inputMu.Lock()
+	defer session.inputMu.Unlock()
+
+	for _, item := range items {
+		if item.Text != "" || item.Key != "" {
+			err = runTmuxCommand(sendKeysArgs(session.TmuxSessionName, item)...)
 		}
-		candidate := filepath.Join(projectsDir, entry.Name(), realSessionID+".jsonl")
-		if _, err := os.Stat(candidate); err == nil {
-			jsonlPath = candidate
-			break
+		if err != nil {
+			return err
+		}
+		if item.DelayMs > 0 {
+			time.Sleep(time.Duration(item.DelayMs) * time.Millisecond)
 		}
 	}
 
-	if jsonlPath == "" {
-		return nil, fmt.Errorf("session file not found for %s", realSessionID)
-	}
+	session.touch()
+	return nil
+}
 
-	// 读取 jsonl 文件
-	file, err := os.Open(jsonlPath)
+// SubmitToSession 将多行文本粘贴到 Claude 输入框并按 Enter 提交。
+// 使用 tmux load-buffer/paste-buffer -p（bracketed paste），文本中的换行不会提前提交。
+// 提交后等待按下 Enter 之后发布的 running 状态（UserPromptSubmit hook）或新的用户消息，
+// 上一回合迟到的 stopped、need_permission 等事件不算确认；
+// 超时后，如果提交前 Claude 处于空闲，再检查屏幕是否显示 Claude 正在工作。
+func (sm *SessionManager) SubmitToSession(sessionID, text string, timeout time.Duration) (string, error) {
+	session, err := sm.GetSession(sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("open file: %w", err)
+		return "", err
 	}
-	defer file.Close()
 
-	var messages []*Message
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	// 先订阅，避免错过提交后立即发生的变化
+	events, cancel := sm.Subscribe(sessionID)
+	defer cancel()
 
-		// 先解析外层
-		var outer struct {
-			Type    string          `json:"type"`
-			Message json.RawMessage `json:"message"`
-		}
-		if err := json.Unmarshal(line, &outer); err != nil {
-			continue
-		}
+	session.inputMu.Lock()
+	before, _ := session.statusWatch()
+	sentAt, err := pasteAndSubmit(session, text)
+	session.inputMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	session.touch()
 
-		if outer.Type == "user" {
-			// user 消息: content 可以是 string 或 list
-			var msg struct {
-				Content interface{} `json:"content"`
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return "", ErrSessionNotFound
 			}
-			if err := json.Unmarshal(outer.Message, &msg); err != nil {
+			if !publishedAfter(event, sentAt) {
 				continue
 			}
-
-			switch c := msg.Content.(type) {
-			case string:
-				if c != "" {
-					messages = append(messages, &Message{Type: "user", Content: c})
-				}
-			case []interface{}:
-				for _, item := range c {
-					if itemMap, ok := item.(map[string]interface{}); ok {
-						if itemMap["type"] == "text" {
-							if text, ok := itemMap["text"].(string); ok && text != "" {
-								messages = append(messages, &Message{Type: "user", Content: text})
-							}
-						}
-						// tool_result 是工具调用返回值，不是真实用户消息，跳过
-					}
-				}
-			}
-		} else if outer.Type == "assistant" {
-			// assistant 消息: content 是 list
-			var msg struct {
-				Content []struct {
-					Type  string          `json:"type"`
-					Text  string          `json:"text,omitempty"`
-					Name  string          `json:"name,omitempty"`
-					Input json.RawMessage `json:"input,omitempty"`
-				} `json:"content"`
-			}
-			if err := json.Unmarshal(outer.Message, &msg); err != nil {
-				continue
+			switch {
+			case event.Type == "status" && event.Status == "running":
+				return event.Status, nil
+			case event.Type == "message" && event.Message != nil && event.Message.Type == "user" && !event.Message.Sidechain:
+				status, _ := session.statusWatch()
+				return status, nil
 			}
-
-			for _, item := range msg.Content {
-				if item.Type == "text" && item.Text != "" {
-					messages = append(messages, &Message{Type: "assistant", Content: item.Text})
-				} else if item.Type == "tool_use" && item.Name != "" {
-					inputBytes, _ := json.Marshal(item.Input)
-					content := fmt.Sprintf("%s: %s", item.Name, string(inputBytes))
-					messages = append(messages, &Message{Type: "tool", Content: content})
+		case <-timer.C:
+			status, _ := session.statusWatch()
+			// 没有收到 hook 通知（例如未配置 hook），通过屏幕判断空闲的 Claude 是否已开始处理。
+			// 提交前已经在运行时屏幕本来就显示忙碌，不能作为确认
+			if before != "running" {
+				output, err := tmuxCmd("capture-pane", "-p", "-t", session.TmuxSessionName).Output()
+				if err == nil && screenShowsBusy(string(output)) {
+					return status, nil
 				}
 			}
+			return status, fmt.Errorf("submission not confirmed: %w", ErrTimeout)
 		}
 	}
+}
 
-	// 限制返回数量
-	if limit > 0 && len(messages) > limit {
-		messages = messages[len(messages)-limit:]
-	}
-
-	return messages, nil
+// pasteAndSubmit 通过 bracketed paste 粘贴文本并按 Enter，返回按下 Enter 的时间。调用方需持有 session.inputMu
+func pasteAndSubmit(session *Session, text string) (time.Time, error) {
+	bufferName := "claude-pty-" + session.ID[:8]
+	load := tmuxCmd("load-buffer", "-b", bufferName, "-")
+	load.Stdin = strings.NewReader(text)
+	if out, err := load.CombinedOutput(); err != nil {
+		return time.Time{}, fmt.Errorf("%w: tmux load-buffer: %w: %s", ErrTmuxFailed, err, string(out))
+	}
+	// -p: bracketed paste，-d: 粘贴后删除 buffer
+	if err := runTmuxCommand("paste-buffer", "-p", "-d", "-b", bufferName, "-t", session.TmuxSessionName); err != nil {
+		return time.Time{}, err
+	}
+	// 等待 Claude 处理完粘贴内容，否则 Enter 可能被当作粘贴的一部分
+	time.Sleep(200 * time.Millisecond)
+	sentAt := time.Now()
+	return sentAt, runTmuxCommand("send-keys", "-t", session.TmuxSessionName, "Enter")
 }
 
-// WriteToSession 向会话发送输入
-func (sm *SessionManager) WriteToSession(sessionID, text string) (int, error) {
-	sm.mu.RLock()
-	session, ok := sm.sessions[sessionID]
-	sm.mu.RUnlock()
+// publishedAfter 判断事件是否在 t 之后发布
+func publishedAfter(event *Event, t time.Time) bool {
+	published, err := time.Parse(time.RFC3339Nano, event.Time)
+	return err == nil && !published.Before(t)
+}
 
-	if !ok {
-		return 0, ErrSessionNotFound
+// InterruptSession 中断当前回合：发送 Escape，force 时再连按两次 Ctrl-C 强制停止。
+// 之后等待 Stop hook 或屏幕回到空闲输入框（用户中断时 Stop hook 不一定触发），返回最终状态。
+// 注意：输入框为空时连按两次 Ctrl-C 会让 Claude 退出。
+func (sm *SessionManager) InterruptSession(sessionID string, force bool, timeout time.Duration) (string, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return "", err
 	}
 
-	session.mu.Lock()
-	defer session.mu.Unlock()
+	// 用户主动中断，停止后不自动提交队列中的 prompt
+	session.pauseQueue()
 
-	// 使用 tmux send-keys 发送输入
-	err := runTmuxCommand("send-keys", "-t", session.TmuxSessionName, text)
-	if err != nil {
-		return 0, err
+	session.inputMu.Lock()
+	keys := [][]string{{"Escape"}}
+	if force {
+		keys = append(keys, []string{"C-c"}, []string{"C-c"})
 	}
+	for _, key := range keys {
+		if err := runTmuxCommand(append([]string{"send-keys", "-t", session.TmuxSessionName}, key...)...); err != nil {
+			session.inputMu.Unlock()
+			return "", err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	session.inputMu.Unlock()
+	session.touch()
 
-	// 发送换行符（如果文本中没有换行）
-	// if text[len(text)-1] != '\n' {
-	// 	err = runTmuxCommand("send-keys", "-t", session.TmuxSessionName, "Enter")
-	// 	if err != nil {
-	// 		return 0, err
-	// 	}
-	// }
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := sm.WaitForStatus(sessionID, func(status string) bool {
+			return status == "stopped"
+		}, 250*time.Millisecond)
+		if err == nil {
+			return status, nil
+		}
+		if !errors.Is(err, ErrTimeout) {
+			return "", err
+		}
 
-	session.LastActivity = time.Now()
+		output, err := tmuxCmd("capture-pane", "-p", "-t", session.TmuxSessionName).Output()
+		if err == nil && !screenShowsBusy(string(output)) {
+			sm.SetStatus(sessionID, "stopped")
+			return "stopped", nil
+		}
 
-	return len(text), nil
+		if time.Now().After(deadline) {
+			return status, fmt.Errorf("interrupt not confirmed: %w", ErrTimeout)
+		}
+	}
+}
+
+// screenShowsBusy 判断屏幕是否显示 Claude 正在处理（状态栏出现 "esc to interrupt"）
+func screenShowsBusy(output string) bool {
+	return strings.Contains(output, "esc to interrupt")
 }
 
 // ReadFromSession 从会话读取输出。
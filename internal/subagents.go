@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isSubagentTool 判断工具调用是否会启动 subagent（新版本 Claude Code 中 Task 改名为 Agent）
+func isSubagentTool(name string) bool {
+	return name == "Task" || name == "Agent"
+}
+
+// GetMessageTree 获取会话消息树：主对话的消息按顺序排列，subagent（sidechain）的消息挂在启动它的
+// Task 调用的 Subagent 字段下。无法确定所属调用的 sidechain 消息保留在顶层。
+// limit > 0 时只返回最后 limit 条顶层消息。
+func (sm *SessionManager) GetMessageTree(sessionID string, limit int, thinking bool) ([]*Message, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	jsonlPath, err := sm.transcriptPath(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 新版本 Claude Code 把 subagent 对话写在 <session>/subagents/ 下的单独文件中
+	paths := []string{jsonlPath}
+	subagentFiles, _ := filepath.Glob(filepath.Join(filepath.Dir(jsonlPath), claudeIDOf(session), "subagents", "*.jsonl"))
+	paths = append(paths, subagentFiles...)
+
+	var messages []*Message
+	parents := make(map[string]string) // 条目 uuid -> parentUuid
+	roots := make(map[string]string)   // sidechain 根条目 uuid -> 第一条 user 消息（subagent 的 prompt）
+	toolUses := make(map[string]*Message)
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			if path == jsonlPath {
+				return nil, fmt.Errorf("open file: %w", err)
+			}
+			continue
+		}
+
+		_, err = scanTranscript(file, 0, func(entry *transcriptEntry, end int64) {
+			if entry.UUID != "" {
+				parents[entry.UUID] = entry.ParentUUID
+			}
+			if entry.Sidechain && entry.ParentUUID == "" {
+				for _, msg := range entry.Messages {
+					if msg.Type == "user" {
+						roots[entry.UUID] = msg.Content
+						break
+					}
+				}
+			}
+
+			for _, msg := range entry.Messages {
+				if msg.Type == "thinking" && !thinking {
+					continue
+				}
+				if msg.Type == "tool" && msg.ToolUseID != "" {
+					toolUses[msg.ToolUseID] = msg
+				}
+				messages = append(messages, msg)
+			}
+			for _, result := range entry.Results {
+				if msg, ok := toolUses[result.ToolUseID]; ok {
+					msg.Result = result.Result
+					continue
+				}
+				messages = append(messages, toolResultMessage(entry, result, end))
+			}
+		})
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 找到 sidechain 消息所在链的根条目
+	rootOf := func(uuid string) string {
+		for i := 0; i < len(parents); i++ {
+			parent, ok := parents[uuid]
+			if !ok || parent == "" {
+				break
+			}
+			uuid = parent
+		}
+		return uuid
+	}
+
+	// 将 sidechain 根条目与 Task 调用对应：优先按 prompt 匹配，否则按顺序分配给尚未匹配的调用
+	var tasks []*Message
+	for _, msg := range messages {
+		if msg.Type == "tool" && !msg.Sidechain && isSubagentTool(msg.ToolName) {
+			tasks = append(tasks, msg)
+		}
+	}
+	owners := make(map[string]*Message) // sidechain 根条目 uuid -> Task 调用
+	matched := make(map[*Message]bool)
+	var unmatched []string
+	for _, msg := range messages {
+		if !msg.Sidechain {
+			continue
+		}
+		root := rootOf(msg.UUID)
+		if _, ok := owners[root]; ok || containsString(unmatched, root) {
+			continue
+		}
+		if task := taskForPrompt(tasks, matched, roots[root]); task != nil {
+			owners[root] = task
+			matched[task] = true
+		} else {
+			unmatched = append(unmatched, root)
+		}
+	}
+	for _, root := range unmatched {
+		for _, task := range tasks {
+			if !matched[task] {
+				owners[root] = task
+				matched[task] = true
+				break
+			}
+		}
+	}
+
+	var tree []*Message
+	for _, msg := range messages {
+		if msg.Sidechain {
+			if task, ok := owners[rootOf(msg.UUID)]; ok {
+				task.Subagent = append(task.Subagent, msg)
+				continue
+			}
+		}
+		tree = append(tree, msg)
+	}
+
+	if limit > 0 && len(tree) > limit {
+		tree = tree[len(tree)-limit:]
+	}
+	return tree, nil
+}
+
+// taskForPrompt 返回 prompt 与 subagent 第一条消息相同且尚未匹配的 Task 调用
+func taskForPrompt(tasks []*Message, matched map[*Message]bool, prompt string) *Message {
+	if prompt == "" {
+		return nil
+	}
+	for _, task := range tasks {
+		if matched[task] {
+			continue
+		}
+		var input struct {
+			Prompt string `json:"prompt"`
+		}
+		json.Unmarshal(task.Input, &input)
+		if strings.TrimSpace(input.Prompt) == strings.TrimSpace(prompt) {
+			return task
+		}
+	}
+	return nil
+}
+
+// containsString 判断 list 中是否包含 s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SubagentEvent 记录 hook 通知的 subagent 启动或结束，返回当前活跃的 subagent 数量
+func (sm *SessionManager) SubagentEvent(sessionID string, started bool, event *HookEvent) (int, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	session.mu.Lock()
+	if started {
+		session.ActiveSubagents++
+	} else if session.ActiveSubagents > 0 {
+		session.ActiveSubagents--
+	}
+	active := session.ActiveSubagents
+	session.mu.Unlock()
+
+	name, status := "subagent_stop", "stopped"
+	if started {
+		name, status = "subagent_start", "started"
+	}
+	detail := ""
+	if event != nil {
+		detail = describeSubagent(event)
+	}
+	session.addHistory(name, "", detail)
+	sm.events.publish(&Event{Type: "subagent", SessionID: sessionID, Status: status})
+	return active, nil
+}
+
+// describeSubagent 生成 subagent 的简短描述：Task 的 description，或 hook 中的 agent_type
+func describeSubagent(event *HookEvent) string {
+	var input struct {
+		Description  string `json:"description"`
+		SubagentType string `json:"subagent_type"`
+	}
+	if len(event.ToolInput) > 0 {
+		json.Unmarshal(event.ToolInput, &input)
+	}
+	switch {
+	case input.Description != "":
+		return input.Description
+	case input.SubagentType != "":
+		return input.SubagentType
+	default:
+		return event.AgentType
+	}
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// rawTodo jsonl 中 todos 字段和 TodoWrite 输入里的一项
+type rawTodo struct {
+	ID         string `json:"id"`
+	Content    string `json:"content"`
+	Status     string `json:"status"`
+	ActiveForm string `json:"activeForm"`
+	Priority   string `json:"priority"`
+}
+
+// parseTodos 解析 todos 数组，格式不正确时返回 nil
+func parseTodos(data json.RawMessage) []*Todo {
+	var raw []*rawTodo
+	if err := json.Unmarshal(data, &raw); err != nil || raw == nil {
+		return nil
+	}
+
+	todos := make([]*Todo, 0, len(raw))
+	for _, t := range raw {
+		todos = append(todos, &Todo{
+			ID:         t.ID,
+			Content:    t.Content,
+			Status:     t.Status,
+			ActiveForm: t.ActiveForm,
+			Priority:   t.Priority,
+		})
+	}
+	return todos
+}
+
+// newTodoList 创建 todo 列表并统计进度
+func newTodoList(todos []*Todo, updatedAt string) *TodoList {
+	list := &TodoList{Todos: todos, Total: len(todos), UpdatedAt: updatedAt}
+	for _, todo := range todos {
+		switch todo.Status {
+		case "completed":
+			list.Completed++
+		case "in_progress":
+			list.InProgress++
+		}
+	}
+	return list
+}
+
+// setTodos 更新会话的 todo 列表
+func (s *Session) setTodos(list *TodoList) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.todos = list
+}
+
+// GetTodos 返回会话当前的 todo 列表；Claude 尚未创建 todo 时返回 nil。
+// 列表由 watcher 实时更新，watcher 未在监听时直接读取 jsonl 文件。
+func (sm *SessionManager) GetTodos(sessionID string) (*TodoList, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	list := session.todos
+	session.mu.Unlock()
+	if list != nil || (session.watcher != nil && session.watcher.watching()) {
+		return list, nil
+	}
+
+	path, err := sm.transcriptPath(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = scanTranscript(file, 0, func(entry *transcriptEntry, end int64) {
+		if entry.Todos != nil {
+			list = newTodoList(entry.Todos, entry.Timestamp)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,437 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrCursorNotFound 游标对应的条目不存在（或偏移超出文件范围）
+var ErrCursorNotFound = errors.New("cursor not found")
+
+// findTranscriptPath 在 ~/.claude/projects 下查找 Claude 会话的 jsonl 文件
+func findTranscriptPath(claudeSessionID string) (string, error) {
+	home := os.Getenv("HOME")
+	projectsDir := filepath.Join(home, ".claude", "projects")
+
+	entries, _ := os.ReadDir(projectsDir)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		candidate := filepath.Join(projectsDir, entry.Name(), claudeSessionID+".jsonl")
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w for %s", ErrTranscriptNotFound, claudeSessionID)
+}
+
+// transcriptPath 返回会话对应的 jsonl 文件路径
+func (sm *SessionManager) transcriptPath(sessionID string) (string, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+	return findTranscriptPath(claudeIDOf(session))
+}
+
+// claudeIDOf 返回会话对应的 Claude session id
+func claudeIDOf(session *Session) string {
+	if session.ClaudeSessionID != "" {
+		return session.ClaudeSessionID
+	}
+	return session.ID
+}
+
+// GetMessages 获取会话消息历史。
+// cursor 为空时返回最后 limit 条消息（limit <= 0 表示全部）；
+// cursor 为字节偏移（上次返回的 next_cursor）或条目 UUID 时，只返回其后的消息，最多 limit 条。
+// thinking 为 true 时包含 thinking 块。
+// 返回值中的 next cursor 为已读取位置的字节偏移，可用于下一次增量读取。
+func (sm *SessionManager) GetMessages(sessionID string, limit int, cursor string, thinking bool) ([]*Message, string, error) {
+	// 优先使用 watcher 维护的内存索引，索引无法覆盖时再读取文件
+	if session, err := sm.GetSession(sessionID); err == nil && session.watcher != nil {
+		if messages, end, ok := session.watcher.query(limit, cursor, thinking); ok {
+			return messages, strconv.FormatInt(end, 10), nil
+		}
+	}
+
+	jsonlPath, err := sm.transcriptPath(sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := os.Open(jsonlPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	var offset int64
+	afterUUID := ""
+	if cursor != "" {
+		if n, err := strconv.ParseInt(cursor, 10, 64); err == nil {
+			if n < 0 {
+				return nil, "", fmt.Errorf("negative offset %d: %w", n, ErrCursorNotFound)
+			}
+			offset = n
+		} else {
+			afterUUID = cursor
+		}
+	}
+
+	if offset > 0 {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, "", fmt.Errorf("stat file: %w", err)
+		}
+		if offset > info.Size() {
+			return nil, "", fmt.Errorf("offset %d beyond end of transcript: %w", offset, ErrCursorNotFound)
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return nil, "", fmt.Errorf("seek file: %w", err)
+		}
+	}
+
+	messages, end, err := readTranscript(file, offset, afterUUID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !thinking {
+		messages = withoutThinking(messages)
+	}
+
+	messages, end = limitMessages(messages, end, limit, cursor)
+	return messages, strconv.FormatInt(end, 10), nil
+}
+
+// limitMessages 按 limit 截取消息并返回对应的游标位置。
+// 没有游标时取最后 limit 条；增量读取时取游标之后的前 limit 条，并且只在行边界处截断，避免同一行的消息被拆开。
+func limitMessages(messages []*Message, end int64, limit int, cursor string) ([]*Message, int64) {
+	if limit <= 0 || len(messages) <= limit {
+		return messages, end
+	}
+
+	if cursor == "" {
+		return messages[len(messages)-limit:], end
+	}
+
+	cut := limit
+	for cut > 0 && messages[cut].end == messages[cut-1].end {
+		cut--
+	}
+	if cut == 0 {
+		cut = limit
+		for cut < len(messages) && messages[cut].end == messages[cut-1].end {
+			cut++
+		}
+	}
+	messages = messages[:cut]
+	return messages, messages[len(messages)-1].end
+}
+
+// withoutThinking 过滤掉 thinking 消息
+func withoutThinking(messages []*Message) []*Message {
+	filtered := messages[:0]
+	for _, msg := range messages {
+		if msg.Type != "thinking" {
+			filtered = append(filtered, msg)
+		}
+	}
+	return filtered
+}
+
+// scanTranscript 从 r 的当前位置（文件偏移 offset）开始逐行解析，只处理以换行结尾的完整行，
+// 对每个条目调用 fn（end 为该行结束处的文件偏移）。返回已处理到的文件偏移。
+func scanTranscript(r io.Reader, offset int64, fn func(entry *transcriptEntry, end int64)) (int64, error) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// 未写完的最后一行留给下一次读取
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("read file: %w", err)
+		}
+		offset += int64(len(line))
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if entry := parseTranscriptLine(line); entry != nil {
+			fn(entry, offset)
+		}
+	}
+}
+
+// readTranscript 从 r 的当前位置（文件偏移 offset）开始解析消息。
+// afterUUID 非空时丢弃该 UUID 对应条目（含）之前的消息。返回消息和已处理到的文件偏移。
+// tool_result 会挂到对应的 tool 消息上；对应的 tool 消息不在本次读取范围内时，作为单独的 tool_result 消息返回。
+func readTranscript(r io.Reader, offset int64, afterUUID string) ([]*Message, int64, error) {
+	var messages []*Message
+	toolUses := make(map[string]*Message)
+	found := afterUUID == ""
+
+	end, err := scanTranscript(r, offset, func(entry *transcriptEntry, end int64) {
+		if !found {
+			if entry.UUID == afterUUID {
+				found = true
+			}
+			return
+		}
+
+		for _, msg := range entry.Messages {
+			msg.end = end
+			if msg.Type == "tool" && msg.ToolUseID != "" {
+				toolUses[msg.ToolUseID] = msg
+			}
+		}
+		messages = append(messages, entry.Messages...)
+
+		for _, result := range entry.Results {
+			if msg, ok := toolUses[result.ToolUseID]; ok {
+				msg.Result = result.Result
+				continue
+			}
+			messages = append(messages, toolResultMessage(entry, result, end))
+		}
+	})
+	if err != nil {
+		return nil, end, err
+	}
+
+	if !found {
+		return nil, end, fmt.Errorf("entry %s: %w", afterUUID, ErrCursorNotFound)
+	}
+	return messages, end, nil
+}
+
+// toolResultMessage 为 tool_result 创建单独的消息
+func toolResultMessage(entry *transcriptEntry, result *toolResultRef, end int64) *Message {
+	return &Message{
+		Type:       "tool_result",
+		Content:    result.Result.Content,
+		UUID:       entry.UUID,
+		ParentUUID: entry.ParentUUID,
+		Timestamp:  entry.Timestamp,
+		ToolUseID:  result.ToolUseID,
+		Result:     result.Result,
+		Sidechain:  entry.Sidechain,
+		end:        end,
+	}
+}
+
+// transcriptEntry 表示 jsonl 中一行解析出的内容
+type transcriptEntry struct {
+	UUID       string
+	ParentUUID string
+	Timestamp  string
+	Sidechain  bool
+	Messages   []*Message
+	Results    []*toolResultRef
+	MessageID  string // assistant 条目的 API message id（同一条消息的多个块共享）
+	Model      string
+	Usage      *Usage
+	CWD        string                 // 条目写入时 Claude 的工作目录
+	ToolResult json.RawMessage        // user 条目的 toolUseResult（工具返回的结构化结果）
+	Backups    map[string]*fileBackup // file-history-snapshot 条目中的文件备份（路径 -> 备份）
+	Todos      []*Todo                // 条目中的 todos 字段或 TodoWrite 调用设置的 todo 列表，nil 表示没有
+}
+
+// fileBackup 表示 file-history-snapshot 中一个文件的备份，BackupFileName 为 nil 表示备份时文件不存在
+type fileBackup struct {
+	BackupFileName *string `json:"backupFileName"`
+	Version        int     `json:"version"`
+	BackupTime     string  `json:"backupTime"`
+}
+
+// toolResultRef 表示 user 条目中的一个 tool_result
+type toolResultRef struct {
+	ToolUseID string
+	Result    *ToolResult
+}
+
+// rawTranscriptLine jsonl 中一行的外层结构
+type rawTranscriptLine struct {
+	Type        string          `json:"type"`
+	UUID        string          `json:"uuid"`
+	ParentUUID  string          `json:"parentUuid"`
+	Timestamp   string          `json:"timestamp"`
+	IsSidechain bool            `json:"isSidechain"`
+	CWD         string          `json:"cwd"`
+	Message     json.RawMessage `json:"message"`
+	ToolResult  json.RawMessage `json:"toolUseResult"`
+	Todos       json.RawMessage `json:"todos"`
+	Snapshot    *struct {
+		TrackedFileBackups map[string]*fileBackup `json:"trackedFileBackups"`
+	} `json:"snapshot"`
+}
+
+// rawContentBlock message.content 中的一个块
+type rawContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// parseTranscriptLine 解析 jsonl 中的一行，无法解析时返回 nil
+func parseTranscriptLine(line []byte) *transcriptEntry {
+	var outer rawTranscriptLine
+	if err := json.Unmarshal(line, &outer); err != nil {
+		return nil
+	}
+
+	entry := &transcriptEntry{
+		UUID:       outer.UUID,
+		ParentUUID: outer.ParentUUID,
+		Timestamp:  outer.Timestamp,
+		Sidechain:  outer.IsSidechain,
+		CWD:        outer.CWD,
+		ToolResult: outer.ToolResult,
+	}
+	if len(outer.Todos) > 0 {
+		entry.Todos = parseTodos(outer.Todos)
+	}
+	newMessage := func(typ, content string) *Message {
+		return &Message{
+			Type:       typ,
+			Content:    content,
+			UUID:       outer.UUID,
+			ParentUUID: outer.ParentUUID,
+			Timestamp:  outer.Timestamp,
+			Sidechain:  outer.IsSidechain,
+		}
+	}
+
+	switch outer.Type {
+	case "file-history-snapshot":
+		if outer.Snapshot != nil {
+			entry.Backups = outer.Snapshot.TrackedFileBackups
+		}
+
+	case "user":
+		// user 消息: content 可以是 string 或 list
+		var msg struct {
+			Content json.RawMessage `json:"content"`
+		}
+		if err := json.Unmarshal(outer.Message, &msg); err != nil {
+			return entry
+		}
+
+		var text string
+		if err := json.Unmarshal(msg.Content, &text); err == nil {
+			if text != "" {
+				entry.Messages = append(entry.Messages, newMessage("user", text))
+			}
+			return entry
+		}
+
+		var blocks []rawContentBlock
+		if err := json.Unmarshal(msg.Content, &blocks); err != nil {
+			return entry
+		}
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				if block.Text != "" {
+					entry.Messages = append(entry.Messages, newMessage("user", block.Text))
+				}
+			case "tool_result":
+				// tool_result 是工具调用返回值，不是真实用户消息，挂到对应的 tool 消息上
+				entry.Results = append(entry.Results, &toolResultRef{
+					ToolUseID: block.ToolUseID,
+					Result: &ToolResult{
+						Content: toolResultText(block.Content),
+						IsError: block.IsError,
+					},
+				})
+			}
+		}
+
+	case "assistant":
+		// assistant 消息: content 是 list
+		var msg struct {
+			ID      string            `json:"id"`
+			Model   string            `json:"model"`
+			Content []rawContentBlock `json:"content"`
+			Usage   *Usage            `json:"usage"`
+		}
+		if err := json.Unmarshal(outer.Message, &msg); err != nil {
+			return entry
+		}
+		entry.MessageID = msg.ID
+		entry.Model = msg.Model
+		entry.Usage = msg.Usage
+
+		for _, block := range msg.Content {
+			var m *Message
+			switch {
+			case block.Type == "text" && block.Text != "":
+				m = newMessage("assistant", block.Text)
+			case block.Type == "thinking" && block.Thinking != "":
+				m = newMessage("thinking", block.Thinking)
+			case block.Type == "tool_use" && block.Name != "":
+				inputBytes, _ := json.Marshal(block.Input)
+				m = newMessage("tool", fmt.Sprintf("%s: %s", block.Name, string(inputBytes)))
+				m.ToolUseID = block.ID
+				m.ToolName = block.Name
+				m.Input = block.Input
+				if block.Name == "TodoWrite" {
+					var input struct {
+						Todos json.RawMessage `json:"todos"`
+					}
+					if json.Unmarshal(block.Input, &input) == nil {
+						entry.Todos = parseTodos(input.Todos)
+					}
+				}
+			default:
+				continue
+			}
+			m.Model = msg.Model
+			entry.Messages = append(entry.Messages, m)
+		}
+	}
+
+	return entry
+}
+
+// toolResultText 提取 tool_result 的文本内容（string 或 text 块列表）
+func toolResultText(content json.RawMessage) string {
+	if len(content) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+
+	var blocks []rawContentBlock
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return string(content)
+	}
+	var parts []string
+	for _, block := range blocks {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
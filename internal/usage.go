@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ModelPrice 模型价格（美元 / 百万 token）
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write"`
+	CacheRead  float64 `json:"cache_read"`
+}
+
+// defaultPricing 默认价格表，按模型名前缀匹配（最长前缀优先），仅用于估算
+var defaultPricing = map[string]ModelPrice{
+	"claude-opus-4-5":   {Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.5},
+	"claude-opus-4":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.5},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-haiku-4-5":  {Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.1},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+}
+
+// LoadPricing 从 JSON 文件加载价格表（模型名前缀 -> 价格），替换默认价格表
+func LoadPricing(path string) (map[string]ModelPrice, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read pricing: %w", err)
+	}
+
+	var pricing map[string]ModelPrice
+	if err := json.Unmarshal(data, &pricing); err != nil {
+		return nil, fmt.Errorf("parse pricing: %w", err)
+	}
+	return pricing, nil
+}
+
+// priceFor 按最长前缀查找模型价格
+func priceFor(pricing map[string]ModelPrice, model string) (ModelPrice, bool) {
+	best := ""
+	for prefix := range pricing {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return pricing[best], true
+}
+
+// cost 计算用量对应的费用（美元）
+func (p ModelPrice) cost(u *Usage) float64 {
+	return (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheCreationInputTokens)*p.CacheWrite +
+		float64(u.CacheReadInputTokens)*p.CacheRead) / 1e6
+}
+
+// add 累加另一份用量
+func (u *Usage) add(other *Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CacheCreationInputTokens += other.CacheCreationInputTokens
+	u.CacheReadInputTokens += other.CacheReadInputTokens
+	u.CostUSD += other.CostUSD
+}
+
+// TotalTokens 返回所有 token 之和（输入、输出、缓存写入、缓存读取）
+func (u *Usage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// BudgetTokens 返回计入 token 预算的用量（输入、输出、缓存写入）。
+// 缓存读取每个回合都会重复计入整个上下文，不反映新增消耗，因此不计入预算
+func (u *Usage) BudgetTokens() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens
+}
+
+// usageTracker 增量统计会话 jsonl 中的 token 用量
+type usageTracker struct {
+	path     string
+	offset   int64
+	messages map[string]*messageUsage // API message id -> 用量
+}
+
+// messageUsage 一条 API 消息的用量。流式输出时同一条消息会写多行，以 output_tokens 最大的一行为准
+type messageUsage struct {
+	model string
+	usage Usage
+}
+
+// report 汇总用量
+func (t *usageTracker) report(pricing map[string]ModelPrice) *UsageReport {
+	report := &UsageReport{Total: &Usage{}, ByModel: make(map[string]*Usage)}
+	for _, mu := range t.messages {
+		u := mu.usage
+		if price, ok := priceFor(pricing, mu.model); ok {
+			u.CostUSD = price.cost(&u)
+		}
+
+		byModel, ok := report.ByModel[mu.model]
+		if !ok {
+			byModel = &Usage{}
+			report.ByModel[mu.model] = byModel
+		}
+		byModel.add(&u)
+		report.Total.add(&u)
+	}
+	return report
+}
+
+// SetPricing 设置价格表
+func (sm *SessionManager) SetPricing(pricing map[string]ModelPrice) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.pricing = pricing
+}
+
+// RefreshUsage 读取 jsonl 新增内容并更新会话用量统计，返回最新汇总
+func (sm *SessionManager) RefreshUsage(sessionID string) (*UsageReport, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	sm.mu.RLock()
+	pricing := sm.pricing
+	sm.mu.RUnlock()
+
+	session.usageMu.Lock()
+	defer session.usageMu.Unlock()
+
+	tracker := session.usage
+	if tracker == nil {
+		path, err := sm.transcriptPath(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		tracker = &usageTracker{path: path, messages: make(map[string]*messageUsage)}
+		session.usage = tracker
+	}
+
+	file, err := os.Open(tracker.path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(tracker.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek file: %w", err)
+	}
+	tracker.offset, err = scanTranscript(file, tracker.offset, func(entry *transcriptEntry, end int64) {
+		if entry.Usage == nil || entry.MessageID == "" {
+			return
+		}
+		prev, ok := tracker.messages[entry.MessageID]
+		if !ok || entry.Usage.OutputTokens >= prev.usage.OutputTokens {
+			tracker.messages[entry.MessageID] = &messageUsage{model: entry.Model, usage: *entry.Usage}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := tracker.report(pricing)
+	session.mu.Lock()
+	report.Budget = session.TokenBudget
+	session.lastUsage = report
+	session.mu.Unlock()
+	return report, nil
+}
+
+// SetTokenBudget 设置会话 token 预算，0 表示不限制。预算按 BudgetTokens 计算，不含缓存读取
+func (sm *SessionManager) SetTokenBudget(sessionID string, budget int64) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.TokenBudget = budget
+	if session.lastUsage != nil {
+		// lastUsage 可能已返回给其他调用方，替换为副本而不是原地修改
+		usage := *session.lastUsage
+		usage.Budget = budget
+		session.lastUsage = &usage
+	}
+	return nil
+}
+
+// overBudgetSessions 刷新有预算且正在运行的会话的用量，返回超出预算的会话 ID
+func (sm *SessionManager) overBudgetSessions() []string {
+	var over []string
+	for _, session := range sm.ListSessions() {
+		session.mu.Lock()
+		budget, status := session.TokenBudget, session.Status
+		session.mu.Unlock()
+		if budget <= 0 || status == "stopped" {
+			continue
+		}
+
+		report, err := sm.RefreshUsage(session.ID)
+		if err != nil {
+			continue
+		}
+		if report.Total.BudgetTokens() > budget {
+			over = append(over, session.ID)
+		}
+	}
+	sort.Strings(over)
+	return over
+}
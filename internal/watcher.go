@@ -0,0 +1,292 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxIndexedMessages 每个会话在内存中保留的最近消息数量
+const maxIndexedMessages = 1000
+
+// transcriptWatcher 使用 inotify 监听会话 jsonl 文件，解析新增行并维护最近消息索引
+type transcriptWatcher struct {
+	sessionID       string
+	claudeSessionID string
+	session         *Session
+	sm              *SessionManager
+
+	path     string
+	offset   int64               // 已解析到的文件偏移
+	start    int64               // 索引覆盖范围的起点：end > start 的消息都在索引中
+	messages []*Message          // 最近的消息（按文件顺序）
+	toolUses map[string]*Message // tool_use id -> 索引中的 tool 消息
+	mu       sync.Mutex
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// startWatcher 为会话启动 jsonl 监听
+func (sm *SessionManager) startWatcher(session *Session) {
+	w := &transcriptWatcher{
+		sessionID:       session.ID,
+		claudeSessionID: claudeIDOf(session),
+		session:         session,
+		sm:              sm,
+		toolUses:        make(map[string]*Message),
+		stop:            make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	session.watcher = w
+	go w.run()
+}
+
+// close 停止监听并等待退出
+func (w *transcriptWatcher) close() {
+	close(w.stop)
+	<-w.stopped
+}
+
+// run 等待 jsonl 文件出现，然后监听写入事件
+func (w *transcriptWatcher) run() {
+	defer close(w.stopped)
+
+	// Claude 在第一次对话后才创建 jsonl 文件
+	var path string
+	for {
+		var err error
+		if path, err = findTranscriptPath(w.claudeSessionID); err == nil {
+			break
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+
+	notify, closeNotify, err := inotifyWatch(path)
+	if err != nil {
+		fmt.Printf("Warning: watch %s: %v\n", path, err)
+		return
+	}
+	defer closeNotify()
+
+	// 设置 path 与首次读取在同一个锁内完成，query 不会看到尚未填充的索引
+	w.mu.Lock()
+	w.path = path
+	w.readNewLocked()
+	w.mu.Unlock()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case _, ok := <-notify:
+			if !ok {
+				return
+			}
+			w.mu.Lock()
+			w.readNewLocked()
+			w.mu.Unlock()
+		}
+	}
+}
+
+// inotifyWatch 监听文件写入，每次有写入时向返回的 channel 发送信号
+func inotifyWatch(path string) (<-chan struct{}, func(), error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inotify init: %w", err)
+	}
+	if _, err := unix.InotifyAddWatch(fd, path, unix.IN_MODIFY|unix.IN_CLOSE_WRITE); err != nil {
+		unix.Close(fd)
+		return nil, nil, fmt.Errorf("inotify add watch: %w", err)
+	}
+
+	// 非阻塞 fd 交给 Go runtime poller，Close 时 Read 会返回
+	file := os.NewFile(uintptr(fd), "inotify")
+	notify := make(chan struct{}, 1)
+	go func() {
+		defer close(notify)
+		buf := make([]byte, 4096)
+		for {
+			if _, err := file.Read(buf); err != nil {
+				return
+			}
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return notify, func() { file.Close() }, nil
+}
+
+// readNewLocked 解析新增的完整行，更新索引并发布 message 事件（调用者需持有 w.mu）
+func (w *transcriptWatcher) readNewLocked() {
+	file, err := os.Open(w.path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	// 文件被截断或重写时从头开始
+	if info, err := file.Stat(); err == nil && info.Size() < w.offset {
+		w.offset, w.start = 0, 0
+		w.messages = nil
+		w.toolUses = make(map[string]*Message)
+	}
+	if _, err := file.Seek(w.offset, io.SeekStart); err != nil {
+		return
+	}
+
+	var added []*Message
+	var todos *TodoList
+	w.offset, err = scanTranscript(file, w.offset, func(entry *transcriptEntry, end int64) {
+		if entry.Todos != nil {
+			todos = newTodoList(entry.Todos, entry.Timestamp)
+		}
+
+		for _, msg := range entry.Messages {
+			msg.end = end
+			if msg.Type == "tool" && msg.ToolUseID != "" {
+				w.toolUses[msg.ToolUseID] = msg
+			}
+		}
+		added = append(added, entry.Messages...)
+
+		// tool_result 挂到 tool 消息上，同时作为单独的消息保留在索引中，
+		// 这样游标位于两者之间的读取者也能拿到结果（query 时会去掉重复）
+		for _, result := range entry.Results {
+			if msg, ok := w.toolUses[result.ToolUseID]; ok {
+				msg.Result = result.Result
+				delete(w.toolUses, result.ToolUseID)
+			}
+			added = append(added, toolResultMessage(entry, result, end))
+		}
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		fmt.Printf("Warning: read %s: %v\n", w.path, err)
+	}
+
+	w.messages = append(w.messages, added...)
+	if len(w.messages) > maxIndexedMessages {
+		evicted := w.messages[:len(w.messages)-maxIndexedMessages]
+		w.messages = append([]*Message(nil), w.messages[len(w.messages)-maxIndexedMessages:]...)
+		w.start = evicted[len(evicted)-1].end
+		for _, msg := range evicted {
+			if msg.ToolUseID != "" {
+				delete(w.toolUses, msg.ToolUseID)
+			}
+		}
+	}
+
+	if todos != nil {
+		w.session.setTodos(todos)
+		w.sm.events.publish(&Event{Type: "todos", SessionID: w.sessionID, Todos: todos})
+	}
+
+	for _, msg := range dedupToolResults(added) {
+		copied := *msg
+		w.sm.events.publish(&Event{
+			Type:      "message",
+			SessionID: w.sessionID,
+			Message:   &copied,
+			Cursor:    strconv.FormatInt(msg.end, 10),
+		})
+	}
+}
+
+// dedupToolResults 去掉 tool 消息也在 messages 中的 tool_result 消息（结果已挂在 tool 消息上）
+func dedupToolResults(messages []*Message) []*Message {
+	toolUses := make(map[string]bool)
+	for _, msg := range messages {
+		if msg.Type == "tool" && msg.ToolUseID != "" {
+			toolUses[msg.ToolUseID] = true
+		}
+	}
+
+	result := make([]*Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Type == "tool_result" && toolUses[msg.ToolUseID] {
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// watching 返回是否已找到 jsonl 文件并开始监听
+func (w *transcriptWatcher) watching() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.path != ""
+}
+
+// query 尝试用内存索引回答 messages 请求，索引无法覆盖时返回 false。
+// 先去重 tool_result、过滤 thinking，再按 limit 截取，保证返回的条数与读取文件时一致
+func (w *transcriptWatcher) query(limit int, cursor string, thinking bool) ([]*Message, int64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.path == "" {
+		return nil, 0, false
+	}
+
+	var from int
+	switch {
+	case cursor == "":
+		from = 0
+	default:
+		if offset, err := strconv.ParseInt(cursor, 10, 64); err == nil {
+			if offset < w.start || offset > w.offset {
+				return nil, 0, false
+			}
+			from = len(w.messages)
+			for i, msg := range w.messages {
+				if msg.end > offset {
+					from = i
+					break
+				}
+			}
+		} else {
+			found := -1
+			for i, msg := range w.messages {
+				if msg.UUID == cursor {
+					found = i
+				}
+			}
+			if found < 0 {
+				return nil, 0, false
+			}
+			from = found + 1
+		}
+	}
+
+	filtered := dedupToolResults(w.messages[from:])
+	if !thinking {
+		filtered = withoutThinking(filtered)
+	}
+	// 取最后 limit 条：索引需要在过滤后仍包含足够的消息，或者覆盖整个文件
+	if cursor == "" && w.start > 0 && (limit <= 0 || limit > len(filtered)) {
+		return nil, 0, false
+	}
+	filtered, end := limitMessages(filtered, w.offset, limit, cursor)
+
+	// 返回副本，避免序列化时与 readNew 并发修改 Result
+	messages := make([]*Message, 0, len(filtered))
+	for _, msg := range filtered {
+		copied := *msg
+		messages = append(messages, &copied)
+	}
+	return messages, end, true
+}
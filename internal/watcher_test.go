@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+// indexedWatcher 构造只覆盖文件后半部分的索引：tool 消息与其 tool_result 各占一条，夹杂 thinking
+func indexedWatcher() *transcriptWatcher {
+	return &transcriptWatcher{
+		path:   "/tmp/transcript.jsonl",
+		start:  100,
+		offset: 600,
+		messages: []*Message{
+			{UUID: "u1", Type: "user", end: 200},
+			{UUID: "t1", Type: "tool", ToolUseID: "call-1", end: 300},
+			{UUID: "r1", Type: "tool_result", ToolUseID: "call-1", end: 400},
+			{UUID: "k1", Type: "thinking", end: 500},
+			{UUID: "a1", Type: "assistant", end: 600},
+		},
+	}
+}
+
+func TestWatcherQueryFiltersBeforeLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		cursor   string
+		thinking bool
+		want     []string // nil 表示索引无法覆盖
+	}{
+		{"去重后仍足够", 3, "", true, []string{"t1", "k1", "a1"}},
+		{"去重后不足时回退读文件", 5, "", true, nil},
+		{"过滤 thinking 后仍足够", 3, "", false, []string{"u1", "t1", "a1"}},
+		{"过滤 thinking 后不足时回退读文件", 4, "", false, nil},
+		{"不限条数且索引不完整", 0, "", false, nil},
+		{"游标之后取前 limit 条", 2, "u1", false, []string{"t1", "a1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, _, ok := indexedWatcher().query(tt.limit, tt.cursor, tt.thinking)
+			if tt.want == nil {
+				if ok {
+					t.Fatalf("expected fallback, got %d messages", len(messages))
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("unexpected fallback")
+			}
+			var got []string
+			for _, msg := range messages {
+				got = append(got, msg.UUID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// Package client 是 claude-pty server 的 Go 客户端，通过 Unix socket（或 server 的 TCP listener）调用 HTTP API。
+//
+//	c := client.New("")
+//	session, err := c.Create(ctx, client.CreateOptions{CWD: "/path/to/project"})
+//	_, err = c.Submit(ctx, session.ID, "写一个 hello world", 0)
+//	status, err := c.Wait(ctx, session.ID)
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-pty/internal"
+)
+
+// 协议类型。公开的字段和方法用到的类型都在这里有别名，模块外的代码无法直接引用 internal 包
+type (
+	Request      = internal.Request
+	Response     = internal.Response
+	SessionInfo  = internal.SessionInfo
+	HistoryEntry = internal.HistoryEntry
+	UsageReport  = internal.UsageReport
+	Usage        = internal.Usage
+	Message      = internal.Message
+	ToolResult   = internal.ToolResult
+	Event        = internal.Event
+	InputItem    = internal.InputItem
+	SearchResult = internal.SearchResult
+	FileChange   = internal.FileChange
+	TodoList     = internal.TodoList
+	Todo         = internal.Todo
+	Policy       = internal.Policy
+	PolicyRule   = internal.PolicyRule
+	HookEvent    = internal.HookEvent
+	AuditEntry   = internal.AuditEntry
+	Scope        = internal.Scope
+	QuotaUsage   = internal.QuotaUsage
+	Limits       = internal.Limits
+	CallerUsage  = internal.CallerUsage
+	ErrorCode    = internal.ErrorCode
+)
+
+// 权限范围
+const (
+	ScopeRead  = internal.ScopeRead
+	ScopeInput = internal.ScopeInput
+	ScopeAdmin = internal.ScopeAdmin
+)
+
+// 自动授权规则的决策
+const (
+	DecisionAllow = internal.DecisionAllow
+	DecisionDeny  = internal.DecisionDeny
+)
+
+// DefaultPollInterval Wait 默认的轮询间隔
+const DefaultPollInterval = time.Second
+
+// Client claude-pty 客户端，可并发使用，底层连接会被复用
+type Client struct {
+	socketPath string
+	baseURL    string // 请求的 URL 前缀，Unix socket 时为 http://localhost
+	token      string // Bearer token（TCP 连接时使用）
+	httpClient *http.Client
+
+	// PollInterval Wait 轮询状态的间隔
+	PollInterval time.Duration
+	// Raw 请求未脱敏的输出（需要管理员权限，调用会写入审计日志）
+	Raw bool
+}
+
+// New 创建连接到 socketPath 的客户端，socketPath 为空时使用默认路径（$CLAUDE_PTY_SOCKET 或 /tmp/claude-pty.sock）
+func New(socketPath string) *Client {
+	if socketPath == "" {
+		socketPath = internal.GetDefaultSocketPath()
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &Client{
+		socketPath:   socketPath,
+		baseURL:      "http://localhost",
+		httpClient:   &http.Client{Transport: transport},
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// NewRemote 创建通过 TCP 连接 server 的客户端，baseURL 如 https://host:7681，token 为 Bearer token。
+// tlsConfig 可为 nil；使用自签名证书时通过它指定 RootCAs。
+func NewRemote(baseURL, token string, tlsConfig *tls.Config) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		token:        token,
+		httpClient:   &http.Client{Transport: transport},
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// SocketPath 返回客户端连接的 socket 路径（TCP 客户端为空）
+func (c *Client) SocketPath() string {
+	return c.socketPath
+}
+
+// Do 通过 action 接口发送请求；服务端返回失败时错误为 *Error
+func (c *Client) Do(ctx context.Context, req Request) (*Response, error) {
+	if c.Raw {
+		req.Raw = true
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	return c.send(ctx, http.MethodPost, "/", body)
+}
+
+// get 发送 GET 请求
+func (c *Client) get(ctx context.Context, path string) (*Response, error) {
+	return c.send(ctx, http.MethodGet, path, nil)
+}
+
+// send 发送请求并解析响应
+func (c *Client) send(ctx context.Context, method, path string, body []byte) (*Response, error) {
+	httpResp, err := c.open(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	return decodeResponse(httpResp.StatusCode, data)
+}
+
+// open 发送请求并返回未读取的 HTTP 响应
+func (c *Client) open(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set(internal.APIVersionHeader, strconv.Itoa(internal.APIVersion))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	return resp, nil
+}
+
+// decodeResponse 解析响应，失败时返回 *Error
+func decodeResponse(statusCode int, data []byte) (*Response, error) {
+	var resp Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("unmarshal response (HTTP %d): %w", statusCode, err)
+	}
+	if !resp.Success {
+		return &resp, &Error{Code: resp.Code, Message: resp.Error, StatusCode: statusCode, Response: &resp}
+	}
+	return &resp, nil
+}
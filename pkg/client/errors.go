@@ -0,0 +1,69 @@
+package client
+
+import "claude-pty/internal"
+
+// Error 服务端返回的失败。可以用 errors.Is 与 ErrSessionNotFound 等比较（按错误码匹配），
+// 或用 errors.As 取出完整响应（如 result 的 validation_errors）。
+type Error struct {
+	Code       ErrorCode
+	Message    string
+	StatusCode int       // HTTP 状态码（action 接口始终为 200）
+	Response   *Response // 完整响应，比较用的错误值中为 nil
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return string(e.Code)
+	}
+	return e.Message
+}
+
+// Is 错误码相同即视为同一错误
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// 错误码
+const (
+	CodeInvalidRequest     = internal.CodeInvalidRequest
+	CodeUnknownAction      = internal.CodeUnknownAction
+	CodeUnsupportedVersion = internal.CodeUnsupportedVersion
+	CodeUnauthorized       = internal.CodeUnauthorized
+	CodeForbidden          = internal.CodeForbidden
+	CodeQuotaExceeded      = internal.CodeQuotaExceeded
+	CodeInputTooLarge      = internal.CodeInputTooLarge
+	CodeSessionNotFound    = internal.CodeSessionNotFound
+	CodeSessionExists      = internal.CodeSessionExists
+	CodeInvalidState       = internal.CodeInvalidState
+	CodeCursorNotFound     = internal.CodeCursorNotFound
+	CodeTranscriptNotFound = internal.CodeTranscriptNotFound
+	CodeNoResult           = internal.CodeNoResult
+	CodeSchemaValidation   = internal.CodeSchemaValidation
+	CodeTimeout            = internal.CodeTimeout
+	CodeTmuxFailure        = internal.CodeTmuxFailure
+	CodeClaudeNotFound     = internal.CodeClaudeNotFound
+	CodeInternal           = internal.CodeInternal
+)
+
+// 可用于 errors.Is 比较的错误
+var (
+	ErrInvalidRequest     = &Error{Code: CodeInvalidRequest}
+	ErrUnknownAction      = &Error{Code: CodeUnknownAction}
+	ErrUnsupportedVersion = &Error{Code: CodeUnsupportedVersion}
+	ErrUnauthorized       = &Error{Code: CodeUnauthorized}
+	ErrForbidden          = &Error{Code: CodeForbidden}
+	ErrQuotaExceeded      = &Error{Code: CodeQuotaExceeded}
+	ErrInputTooLarge      = &Error{Code: CodeInputTooLarge}
+	ErrSessionNotFound    = &Error{Code: CodeSessionNotFound}
+	ErrSessionExists      = &Error{Code: CodeSessionExists}
+	ErrInvalidState       = &Error{Code: CodeInvalidState}
+	ErrCursorNotFound     = &Error{Code: CodeCursorNotFound}
+	ErrTranscriptNotFound = &Error{Code: CodeTranscriptNotFound}
+	ErrNoResult           = &Error{Code: CodeNoResult}
+	ErrSchemaValidation   = &Error{Code: CodeSchemaValidation}
+	ErrTimeout            = &Error{Code: CodeTimeout}
+	ErrTmuxFailure        = &Error{Code: CodeTmuxFailure}
+	ErrClaudeNotFound     = &Error{Code: CodeClaudeNotFound}
+	ErrInternal           = &Error{Code: CodeInternal}
+)
@@ -0,0 +1,381 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CreateOptions 创建会话的参数
+type CreateOptions struct {
+	CWD         string  // 工作目录，为空时使用 server 的当前目录
+	Policy      *Policy // 会话级自动授权规则
+	TokenBudget int64   // token 预算（不含缓存读取），0 表示不限制
+}
+
+// Create 创建会话
+func (c *Client) Create(ctx context.Context, opts CreateOptions) (*SessionInfo, error) {
+	resp, err := c.Do(ctx, Request{Action: "create", CWD: opts.CWD, Policy: opts.Policy, Budget: opts.TokenBudget})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Session, nil
+}
+
+// List 列出所有会话
+func (c *Client) List(ctx context.Context) ([]*SessionInfo, error) {
+	resp, err := c.get(ctx, "/list")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Sessions, nil
+}
+
+// Info 获取会话信息
+func (c *Client) Info(ctx context.Context, sessionID string) (*SessionInfo, error) {
+	resp, err := c.Do(ctx, Request{Action: "get_info", SessionID: sessionID})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Session, nil
+}
+
+// Status 获取会话状态
+func (c *Client) Status(ctx context.Context, sessionID string) (string, error) {
+	resp, err := c.Do(ctx, Request{Action: "get_status", SessionID: sessionID})
+	if err != nil {
+		return "", err
+	}
+	return resp.Status, nil
+}
+
+// SetStatus 设置会话状态（running、stopped、need_permission），通常由 hook 调用
+func (c *Client) SetStatus(ctx context.Context, sessionID, status string) error {
+	_, err := c.Do(ctx, Request{Action: "set_status", SessionID: sessionID, Status: status})
+	return err
+}
+
+// Delete 删除会话
+func (c *Client) Delete(ctx context.Context, sessionID string) error {
+	_, err := c.Do(ctx, Request{Action: "delete", SessionID: sessionID})
+	return err
+}
+
+// Output 获取终端输出。limit 为空时返回全部，"100" 为最后 100 行，">1" 为最后 1 个用户回合，".1" 为最后 1 个块
+func (c *Client) Output(ctx context.Context, sessionID, limit string) (string, error) {
+	resp, err := c.Do(ctx, Request{Action: "get", SessionID: sessionID, LimitStr: limit})
+	if err != nil {
+		return "", err
+	}
+	return resp.Output, nil
+}
+
+// Input 直接发送文本（传给 tmux send-keys，"Enter" 等会被当作按键）
+func (c *Client) Input(ctx context.Context, sessionID, text string) error {
+	_, err := c.Do(ctx, Request{Action: "input", SessionID: sessionID, Text: text})
+	return err
+}
+
+// SendItems 发送结构化输入：字面文本与按键明确区分
+func (c *Client) SendItems(ctx context.Context, sessionID string, items []*InputItem) error {
+	_, err := c.Do(ctx, Request{Action: "input", SessionID: sessionID, Items: items})
+	return err
+}
+
+// SendKeys 按顺序发送按键（名称同 tmux：Enter、Escape、Up、C-c 等）
+func (c *Client) SendKeys(ctx context.Context, sessionID string, keys ...string) error {
+	items := make([]*InputItem, len(keys))
+	for i, key := range keys {
+		items[i] = &InputItem{Key: key}
+	}
+	return c.SendItems(ctx, sessionID, items)
+}
+
+// Submit 粘贴 prompt 并按 Enter，等待 Claude 开始处理，返回提交后的状态。
+// timeout 为等待确认的时间，0 使用服务端默认值。
+func (c *Client) Submit(ctx context.Context, sessionID, text string, timeout time.Duration) (string, error) {
+	resp, err := c.Do(ctx, Request{Action: "submit", SessionID: sessionID, Text: text, Timeout: seconds(timeout)})
+	return statusOf(resp), err
+}
+
+// Interrupt 中断当前回合，返回中断后的状态；force 为 true 时额外连按两次 Ctrl-C
+func (c *Client) Interrupt(ctx context.Context, sessionID string, force bool) (string, error) {
+	resp, err := c.Do(ctx, Request{Action: "interrupt", SessionID: sessionID, Force: force})
+	return statusOf(resp), err
+}
+
+// RespondPermission 回应权限对话框（decision 为 allow 或 deny），返回回应后的状态
+func (c *Client) RespondPermission(ctx context.Context, sessionID, decision string) (string, error) {
+	resp, err := c.Do(ctx, Request{Action: "respond_permission", SessionID: sessionID, Decision: decision})
+	return statusOf(resp), err
+}
+
+// Enqueue 把 prompt 加入队列，会话变为 stopped 时自动提交，返回当前队列
+func (c *Client) Enqueue(ctx context.Context, sessionID, text string) ([]string, error) {
+	resp, err := c.Do(ctx, Request{Action: "enqueue", SessionID: sessionID, Text: text})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Queue, nil
+}
+
+// Queue 返回待提交的 prompt 队列
+func (c *Client) Queue(ctx context.Context, sessionID string) ([]string, error) {
+	resp, err := c.Do(ctx, Request{Action: "queue", SessionID: sessionID})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Queue, nil
+}
+
+// ClearQueue 清空 prompt 队列
+func (c *Client) ClearQueue(ctx context.Context, sessionID string) error {
+	_, err := c.Do(ctx, Request{Action: "clear_queue", SessionID: sessionID})
+	return err
+}
+
+// SetBudget 设置 token 预算，0 表示不限制
+func (c *Client) SetBudget(ctx context.Context, sessionID string, tokens int64) error {
+	_, err := c.Do(ctx, Request{Action: "set_budget", SessionID: sessionID, Budget: tokens})
+	return err
+}
+
+// SetPolicy 设置会话级自动授权规则，nil 表示清除
+func (c *Client) SetPolicy(ctx context.Context, sessionID string, policy *Policy) error {
+	_, err := c.Do(ctx, Request{Action: "set_policy", SessionID: sessionID, Policy: policy})
+	return err
+}
+
+// Wait 轮询会话状态直到变为 until 中的任意一个（默认 stopped 或 need_permission），返回最终状态。
+// ctx 取消或超时时返回 ctx.Err() 和最后一次读到的状态。
+func (c *Client) Wait(ctx context.Context, sessionID string, until ...string) (string, error) {
+	if len(until) == 0 {
+		until = []string{"stopped", "need_permission"}
+	}
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err := c.Status(ctx, sessionID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return status, ctx.Err()
+			}
+			return status, err
+		}
+		for _, want := range until {
+			if status == want {
+				return status, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// MessagesOptions 读取消息的参数
+type MessagesOptions struct {
+	Limit    int    // 只返回最后 limit 条（cursor 为空时）
+	Cursor   string // 上次返回的 next cursor，只返回之后新增的消息
+	Thinking bool   // 包含 thinking 块
+	Tree     bool   // subagent 消息挂在 Task 调用下（不支持 cursor）
+}
+
+// Messages 读取对话消息，返回消息和下一次增量读取的游标
+func (c *Client) Messages(ctx context.Context, sessionID string, opts MessagesOptions) ([]*Message, string, error) {
+	resp, err := c.Do(ctx, Request{
+		Action:    "messages",
+		SessionID: sessionID,
+		Limit:     opts.Limit,
+		Cursor:    opts.Cursor,
+		Thinking:  opts.Thinking,
+		Tree:      opts.Tree,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.Messages, resp.NextCursor, nil
+}
+
+// Export 导出对话，format 为 markdown（默认）或 html
+func (c *Client) Export(ctx context.Context, sessionID, format string, thinking bool) (string, error) {
+	resp, err := c.Do(ctx, Request{Action: "export", SessionID: sessionID, Format: format, Thinking: thinking})
+	if err != nil {
+		return "", err
+	}
+	return resp.Output, nil
+}
+
+// SearchOptions 搜索参数，Query、Tool、Path 至少指定一个
+type SearchOptions struct {
+	Query       string
+	Regex       bool
+	Tool        string
+	Path        string
+	SessionID   string // 只搜索一个会话
+	AllProjects bool   // 搜索 ~/.claude/projects 下所有会话
+	Thinking    bool
+	Limit       int
+}
+
+// Search 跨会话搜索对话
+func (c *Client) Search(ctx context.Context, opts SearchOptions) ([]*SearchResult, error) {
+	resp, err := c.Do(ctx, Request{
+		Action:      "search",
+		SessionID:   opts.SessionID,
+		Query:       opts.Query,
+		Regex:       opts.Regex,
+		Tool:        opts.Tool,
+		Path:        opts.Path,
+		AllProjects: opts.AllProjects,
+		Thinking:    opts.Thinking,
+		Limit:       opts.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// Changes 返回 agent 改动的文件；diff 为 true 时包含 unified diff，path 非空时只返回该文件
+func (c *Client) Changes(ctx context.Context, sessionID string, diff bool, path string) ([]*FileChange, error) {
+	resp, err := c.Do(ctx, Request{Action: "changes", SessionID: sessionID, Diff: diff, Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Changes, nil
+}
+
+// Todos 返回 Claude 当前的 todo 列表，尚未创建时为 nil
+func (c *Client) Todos(ctx context.Context, sessionID string) (*TodoList, error) {
+	resp, err := c.Do(ctx, Request{Action: "todos", SessionID: sessionID})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Todos, nil
+}
+
+// Result 最近一个回合的最终回复
+type Result struct {
+	Output string          // 回复文本
+	JSON   json.RawMessage // 提取出的 JSON（请求 JSON 或 schema 时）
+}
+
+// Result 返回最近一个回合的最终回复。asJSON 或 schema 非空时提取回复中的 JSON 并按 schema 校验；
+// 校验失败时错误为 ErrSchemaValidation，errors.As 得到的 *Error.Response.ValidationErrors 为错误列表。
+func (c *Client) Result(ctx context.Context, sessionID string, asJSON bool, schema json.RawMessage) (*Result, error) {
+	resp, err := c.Do(ctx, Request{Action: "result", SessionID: sessionID, JSON: asJSON, Schema: schema})
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Output: resp.Output, JSON: resp.Result}, nil
+}
+
+// Audit 查询审计日志（需要管理员权限），返回最后 limit 条记录（0 使用服务端默认值）。
+// sessionID 为空时不过滤会话，since 为零值时不过滤时间
+func (c *Client) Audit(ctx context.Context, sessionID string, since time.Time, limit int) ([]*AuditEntry, error) {
+	req := Request{Action: "audit", SessionID: sessionID, Limit: limit}
+	if !since.IsZero() {
+		req.Since = since.Format(time.RFC3339)
+	}
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Audit, nil
+}
+
+// Quotas 返回配额设置和每个调用方的当前用量（需要管理员权限）
+func (c *Client) Quotas(ctx context.Context) (*QuotaUsage, error) {
+	resp, err := c.Do(ctx, Request{Action: "quotas"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Quotas, nil
+}
+
+// Version 返回服务端的 API 版本和支持的最低版本
+func (c *Client) Version(ctx context.Context) (int, int, error) {
+	resp, err := c.get(ctx, "/version")
+	if err != nil {
+		return 0, 0, err
+	}
+	return resp.APIVersion, resp.MinAPIVersion, nil
+}
+
+// Events 订阅事件（sessionID 为空时订阅所有会话），对每个事件调用 fn，直到 fn 返回错误、
+// 服务端关闭连接（返回 nil）或 ctx 取消（返回 ctx.Err()）
+func (c *Client) Events(ctx context.Context, sessionID string, fn func(*Event) error) error {
+	query := url.Values{}
+	if sessionID != "" {
+		query.Set("session_id", sessionID)
+	}
+	if c.Raw {
+		query.Set("raw", "true")
+	}
+	path := "/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	httpResp, err := c.open(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(httpResp.Body)
+		_, err := decodeResponse(httpResp.StatusCode, data)
+		if err == nil {
+			err = fmt.Errorf("unexpected HTTP status %d", httpResp.StatusCode)
+		}
+		return err
+	}
+
+	// 每行一个事件
+	decoder := json.NewDecoder(httpResp.Body)
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("decode event: %w", err)
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+}
+
+// seconds 将超时转换为请求中的秒数（不足一秒按一秒）
+func seconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// statusOf 返回响应中的状态（失败响应也可能带有状态）
+func statusOf(resp *Response) string {
+	if resp == nil {
+		return ""
+	}
+	return resp.Status
+}
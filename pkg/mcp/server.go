@@ -0,0 +1,235 @@
+// Package mcp 通过 stdio 提供 Model Context Protocol server，把 claude-pty 的会话操作暴露为 MCP 工具，
+// 让上层 Claude 直接调用工具编排 sub-agent。每个工具都通过 pkg/client 调用 socket API。
+//
+// 传输格式为每行一个 JSON-RPC 2.0 消息；stdout 只输出协议消息，日志应写到 stderr。
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"claude-pty/internal"
+	"claude-pty/pkg/client"
+)
+
+// ProtocolVersion 支持的 MCP 协议版本
+const ProtocolVersion = "2024-11-05"
+
+// JSON-RPC 错误码
+const (
+	codeParseError     = -32700
+	codeInternalError  = -32603
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// message JSON-RPC 请求、通知或响应
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError JSON-RPC 错误
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Server MCP server
+type Server struct {
+	client *client.Client
+
+	writeMu sync.Mutex
+	out     io.Writer
+
+	mu      sync.Mutex
+	pending map[string]context.CancelFunc // 正在执行的请求，用于 notifications/cancelled
+}
+
+// NewServer 创建使用 c 调用 claude-pty 的 MCP server
+func NewServer(c *client.Client) *Server {
+	return &Server{client: c, pending: make(map[string]context.CancelFunc)}
+}
+
+// Serve 从 r 读取请求并把响应写到 w，直到 r 结束。ctx 是所有请求的父 context。
+// 请求并发处理，因此长时间的 wait 不会阻塞 ping 或其他工具调用。
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.out = w
+
+	// 输入结束后等待仍在执行的请求写完响应
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			s.writeError(json.RawMessage("null"), codeParseError, "parse error: "+err.Error())
+			continue
+		}
+		if msg.Method == "" {
+			// 客户端发来的响应（本 server 不发送请求），忽略
+			continue
+		}
+
+		if len(msg.ID) == 0 {
+			s.handleNotification(msg)
+			continue
+		}
+
+		reqCtx, reqCancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.pending[string(msg.ID)] = reqCancel
+		s.mu.Unlock()
+
+		wg.Add(1)
+		go func(msg message) {
+			defer wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.pending, string(msg.ID))
+				s.mu.Unlock()
+				reqCancel()
+			}()
+			s.handleRequest(reqCtx, msg)
+		}(msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read input: %w", err)
+	}
+	return nil
+}
+
+// handleNotification 处理通知（没有 id，不需要响应）
+func (s *Server) handleNotification(msg message) {
+	if msg.Method != "notifications/cancelled" {
+		return
+	}
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return
+	}
+	s.mu.Lock()
+	cancel := s.pending[string(params.RequestID)]
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// handleRequest 处理请求并写回响应
+func (s *Server) handleRequest(ctx context.Context, msg message) {
+	switch msg.Method {
+	case "initialize":
+		s.writeResult(msg.ID, initializeResult())
+	case "ping":
+		s.writeResult(msg.ID, struct{}{})
+	case "tools/list":
+		s.writeResult(msg.ID, map[string]any{"tools": toolList()})
+	case "tools/call":
+		s.handleToolCall(ctx, msg)
+	default:
+		s.writeError(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+	}
+}
+
+// initializeResult initialize 的结果：声明 tools 能力。只支持一个协议版本，客户端请求其他版本时由客户端决定是否继续
+func initializeResult() map[string]any {
+	return map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{"tools": map[string]any{}},
+		"serverInfo": map[string]any{
+			"name":    "claude-pty",
+			"version": strconv.Itoa(internal.APIVersion),
+		},
+		"instructions": "Each tool manages a Claude Code sub-agent running in tmux. " +
+			"Typical flow: create_session, send_prompt, wait, then get_messages or get_output; " +
+			"when wait returns need_permission, inspect get_output and call approve_permission.",
+	}
+}
+
+// handleToolCall 调用工具。工具自身的失败（如会话不存在）作为 isError 结果返回，让模型可以看到并处理
+func (s *Server) handleToolCall(ctx context.Context, msg message) {
+	var params struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		s.writeError(msg.ID, codeInvalidParams, "invalid params: "+err.Error())
+		return
+	}
+
+	t, ok := tools[params.Name]
+	if !ok {
+		s.writeError(msg.ID, codeInvalidParams, "unknown tool: "+params.Name)
+		return
+	}
+	args := params.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+
+	text, err := t.call(ctx, s.client, args)
+	if err != nil {
+		s.writeResult(msg.ID, toolResult(describeError(err), true))
+		return
+	}
+	s.writeResult(msg.ID, toolResult(text, false))
+}
+
+// toolResult 构造 tools/call 的结果
+func toolResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []any{map[string]any{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// describeError 工具错误的文本，带上服务端的错误码便于模型判断
+func describeError(err error) string {
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.Code != "" {
+		return string(apiErr.Code) + ": " + apiErr.Error()
+	}
+	return err.Error()
+}
+
+// writeResult 写成功响应
+func (s *Server) writeResult(id json.RawMessage, result any) {
+	s.write(message{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+// writeError 写错误响应
+func (s *Server) writeError(id json.RawMessage, code int, msg string) {
+	s.write(message{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: msg}})
+}
+
+// write 写一行 JSON-RPC 消息，多个请求并发完成时保证不交错
+func (s *Server) write(msg message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data, _ = json.Marshal(message{JSONRPC: "2.0", ID: msg.ID, Error: &rpcError{Code: codeInternalError, Message: err.Error()}})
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.out.Write(append(data, '\n'))
+}
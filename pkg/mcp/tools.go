@@ -0,0 +1,271 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"claude-pty/pkg/client"
+)
+
+// DefaultWaitTimeout wait 工具默认的最长等待时间
+const DefaultWaitTimeout = 10 * time.Minute
+
+// tool MCP 工具：描述、参数 schema 和实现
+type tool struct {
+	description string
+	schema      map[string]any
+	call        func(ctx context.Context, c *client.Client, args json.RawMessage) (string, error)
+}
+
+// sessionIDProp 会话 ID 参数
+var sessionIDProp = map[string]any{"type": "string", "description": "Session ID returned by create_session"}
+
+// tools 所有工具，按名称索引
+var tools = map[string]tool{
+	"create_session": {
+		description: "Start a new Claude Code sub-agent in tmux. Returns the session, including its id.",
+		schema: object(map[string]any{
+			"cwd":          map[string]any{"type": "string", "description": "Working directory; defaults to the daemon's directory"},
+			"token_budget": map[string]any{"type": "integer", "description": "Interrupt the sub-agent after this many input, output and cache-write tokens; cache reads are not counted (0 = unlimited)"},
+		}),
+		call: createSession,
+	},
+	"send_prompt": {
+		description: "Paste a prompt into the sub-agent and press Enter. Returns the status after submission; call wait to block until the turn finishes.",
+		schema: object(map[string]any{
+			"session_id": sessionIDProp,
+			"prompt":     map[string]any{"type": "string", "description": "Prompt text; may span multiple lines"},
+		}, "session_id", "prompt"),
+		call: sendPrompt,
+	},
+	"wait": {
+		description: "Block until the sub-agent is stopped (turn finished) or need_permission (waiting for approval). Returns the status.",
+		schema: object(map[string]any{
+			"session_id":      sessionIDProp,
+			"timeout_seconds": map[string]any{"type": "integer", "description": "Give up after this many seconds (default 600)"},
+		}, "session_id"),
+		call: waitSession,
+	},
+	"get_output": {
+		description: "Read the sub-agent's terminal screen. Use it to see a pending permission prompt before approving.",
+		schema: object(map[string]any{
+			"session_id": sessionIDProp,
+			"limit":      map[string]any{"type": "string", "description": "N for the last N lines, >N for the last N user turns, .N for the last N blocks; empty for everything"},
+		}, "session_id"),
+		call: getOutput,
+	},
+	"get_messages": {
+		description: "Read the structured conversation (user, assistant, tool calls and results). Returns JSON with messages and next_cursor; pass next_cursor back to read only new messages.",
+		schema: object(map[string]any{
+			"session_id": sessionIDProp,
+			"limit":      map[string]any{"type": "integer", "description": "Only the last N messages (ignored with cursor)"},
+			"cursor":     map[string]any{"type": "string", "description": "next_cursor from a previous call"},
+			"thinking":   map[string]any{"type": "boolean", "description": "Include thinking blocks"},
+		}, "session_id"),
+		call: getMessages,
+	},
+	"approve_permission": {
+		description: "Answer the sub-agent's pending permission prompt: allow runs the tool, deny rejects it and stops the turn. Fails unless the status is need_permission.",
+		schema: object(map[string]any{
+			"session_id": sessionIDProp,
+			"decision":   map[string]any{"type": "string", "enum": []string{"allow", "deny"}, "description": "Defaults to allow"},
+		}, "session_id"),
+		call: approvePermission,
+	},
+	"delete_session": {
+		description: "Kill the sub-agent and its tmux session. Only do this when the user asks; sessions can be resumed with follow-up prompts.",
+		schema: object(map[string]any{
+			"session_id": sessionIDProp,
+		}, "session_id"),
+		call: deleteSession,
+	},
+}
+
+// toolList tools/list 返回的工具列表（按名称排序）
+func toolList() []any {
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]any, 0, len(names))
+	for _, name := range names {
+		list = append(list, map[string]any{
+			"name":        name,
+			"description": tools[name].description,
+			"inputSchema": tools[name].schema,
+		})
+	}
+	return list
+}
+
+// object 构造参数的 object schema
+func object(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// decodeArgs 解析工具参数并检查 session_id
+func decodeArgs(args json.RawMessage, v any, sessionID *string) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	if sessionID != nil && *sessionID == "" {
+		return errors.New("session_id required")
+	}
+	return nil
+}
+
+// marshalText 把结果格式化为 JSON 文本
+func marshalText(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func createSession(ctx context.Context, c *client.Client, raw json.RawMessage) (string, error) {
+	var args struct {
+		CWD         string `json:"cwd"`
+		TokenBudget int64  `json:"token_budget"`
+	}
+	if err := decodeArgs(raw, &args, nil); err != nil {
+		return "", err
+	}
+
+	session, err := c.Create(ctx, client.CreateOptions{CWD: args.CWD, TokenBudget: args.TokenBudget})
+	if err != nil {
+		return "", err
+	}
+	return marshalText(session)
+}
+
+func sendPrompt(ctx context.Context, c *client.Client, raw json.RawMessage) (string, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+		Prompt    string `json:"prompt"`
+	}
+	if err := decodeArgs(raw, &args, &args.SessionID); err != nil {
+		return "", err
+	}
+	if args.Prompt == "" {
+		return "", errors.New("prompt required")
+	}
+
+	status, err := c.Submit(ctx, args.SessionID, args.Prompt, 0)
+	if err != nil {
+		return "", err
+	}
+	return "submitted; status: " + status, nil
+}
+
+func waitSession(ctx context.Context, c *client.Client, raw json.RawMessage) (string, error) {
+	var args struct {
+		SessionID      string `json:"session_id"`
+		TimeoutSeconds int    `json:"timeout_seconds"`
+	}
+	if err := decodeArgs(raw, &args, &args.SessionID); err != nil {
+		return "", err
+	}
+
+	timeout := DefaultWaitTimeout
+	if args.TimeoutSeconds > 0 {
+		timeout = time.Duration(args.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	status, err := c.Wait(ctx, args.SessionID)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "", fmt.Errorf("still %s after %s; call wait again to keep waiting", status, timeout)
+	}
+	if err != nil {
+		return "", err
+	}
+	return "status: " + status, nil
+}
+
+func getOutput(ctx context.Context, c *client.Client, raw json.RawMessage) (string, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+		Limit     string `json:"limit"`
+	}
+	if err := decodeArgs(raw, &args, &args.SessionID); err != nil {
+		return "", err
+	}
+	return c.Output(ctx, args.SessionID, args.Limit)
+}
+
+func getMessages(ctx context.Context, c *client.Client, raw json.RawMessage) (string, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+		Limit     int    `json:"limit"`
+		Cursor    string `json:"cursor"`
+		Thinking  bool   `json:"thinking"`
+	}
+	if err := decodeArgs(raw, &args, &args.SessionID); err != nil {
+		return "", err
+	}
+
+	messages, cursor, err := c.Messages(ctx, args.SessionID, client.MessagesOptions{
+		Limit:    args.Limit,
+		Cursor:   args.Cursor,
+		Thinking: args.Thinking,
+	})
+	if err != nil {
+		return "", err
+	}
+	if messages == nil {
+		messages = []*client.Message{}
+	}
+	return marshalText(map[string]any{"messages": messages, "next_cursor": cursor})
+}
+
+// approvePermission 回应权限对话框：allow 按 Enter 选择默认的 "Yes"，deny 按 Escape 并把状态设为 stopped。
+// 按键和状态更新由服务端的 respond_permission 一次完成，权限不足时不会只执行一半
+func approvePermission(ctx context.Context, c *client.Client, raw json.RawMessage) (string, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+		Decision  string `json:"decision"`
+	}
+	if err := decodeArgs(raw, &args, &args.SessionID); err != nil {
+		return "", err
+	}
+
+	decision := args.Decision
+	if decision == "" {
+		decision = "allow"
+	}
+
+	status, err := c.RespondPermission(ctx, args.SessionID, decision)
+	if err != nil {
+		return "", err
+	}
+	if decision == "deny" {
+		return "denied; status: " + status, nil
+	}
+	return "allowed; status: " + status, nil
+}
+
+func deleteSession(ctx context.Context, c *client.Client, raw json.RawMessage) (string, error) {
+	var args struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := decodeArgs(raw, &args, &args.SessionID); err != nil {
+		return "", err
+	}
+
+	if err := c.Delete(ctx, args.SessionID); err != nil {
+		return "", err
+	}
+	return "deleted " + args.SessionID, nil
+}
@@ -210,8 +210,8 @@ test_error_not_found() {
         --unix-socket "$SOCKET_PATH" \
         http://localhost/)
 
-    if echo "$RESPONSE" | grep -q '"success":false'; then
-        log_pass "错误处理正确: 返回失败"
+    if echo "$RESPONSE" | grep -q '"code":"SESSION_NOT_FOUND"'; then
+        log_pass "错误处理正确: 返回 SESSION_NOT_FOUND"
     else
         log_fail "错误处理失败: 应返回失败但返回: $RESPONSE"
     fi
@@ -244,13 +244,60 @@ test_error_unknown_action() {
         --unix-socket "$SOCKET_PATH" \
         http://localhost/)
 
-    if echo "$RESPONSE" | grep -q '"success":false'; then
+    if echo "$RESPONSE" | grep -q '"code":"UNKNOWN_ACTION"'; then
         log_pass "未知 action 处理正确"
     else
         log_fail "未知 action 处理失败: $RESPONSE"
     fi
 }
 
+# 测试 13: REST 接口 - 状态码
+test_rest_status_codes() {
+    log_info "测试: REST 接口状态码"
+
+    check_code() {
+        local expected=$1 method=$2 path=$3 body=$4
+        local code
+        code=$(curl -s -o /dev/null -w '%{http_code}' -X "$method" \
+            -H "Content-Type: application/json" \
+            ${body:+-d "$body"} \
+            --unix-socket "$SOCKET_PATH" \
+            "http://localhost$path")
+        if [ "$code" = "$expected" ]; then
+            log_pass "$method $path -> $code"
+        else
+            log_fail "$method $path: 期望 $expected，实际 $code"
+        fi
+    }
+
+    check_code 200 GET /sessions
+    check_code 404 GET /sessions/non-existent-id
+    check_code 404 DELETE /sessions/non-existent-id
+    check_code 400 POST /sessions/non-existent-id/input '{}'
+    check_code 400 POST /sessions '{"cwd":"/non-existent-dir"}'
+    check_code 405 PATCH /sessions
+    check_code 200 POST / '{"action":"get_status","session_id":"non-existent-id"}'
+}
+
+# 测试 14: API 版本协商
+test_api_version() {
+    log_info "测试: API 版本协商"
+
+    RESPONSE=$(curl -s --unix-socket "$SOCKET_PATH" http://localhost/version)
+    if echo "$RESPONSE" | grep -q '"min_api_version"'; then
+        log_pass "获取 API 版本成功: $RESPONSE"
+    else
+        log_fail "获取 API 版本失败: $RESPONSE"
+    fi
+
+    RESPONSE=$(curl -s -H "Claude-PTY-API-Version: 999" --unix-socket "$SOCKET_PATH" http://localhost/sessions)
+    if echo "$RESPONSE" | grep -q '"code":"UNSUPPORTED_VERSION"'; then
+        log_pass "不支持的版本被拒绝"
+    else
+        log_fail "不支持的版本未被拒绝: $RESPONSE"
+    fi
+}
+
 # 主测试流程
 main() {
     echo "=========================================="
@@ -312,6 +359,12 @@ main() {
     test_error_unknown_action
     echo ""
 
+    test_rest_status_codes
+    echo ""
+
+    test_api_version
+    echo ""
+
     # 输出总结
     echo "=========================================="
     echo "  测试总结"
@@ -0,0 +1,77 @@
+#!/bin/bash
+# MCP 模式测试：通过 stdio 发送 JSON-RPC 请求，检查握手、工具列表和工具错误
+
+SOCKET_PATH="${CLAUDE_PTY_SOCKET:-/run/user/1000/claude-pty.sock}"
+ROOT_DIR="$(cd "$(dirname "$0")/.." && pwd)"
+
+log_info() {
+    echo "[INFO] $1"
+}
+
+log_pass() {
+    echo "[PASS] $1"
+}
+
+log_fail() {
+    echo "[FAIL] $1"
+}
+
+FAILED=0
+CLIENT="$(mktemp -d)/claude-pty-client"
+trap 'rm -rf "$(dirname "$CLIENT")"' EXIT
+
+if ! (cd "$ROOT_DIR" && go build -o "$CLIENT" ./cmd/client); then
+    log_fail "编译 client 失败"
+    exit 1
+fi
+
+# mcp_call 发送一组请求（每行一个），输出 mcp 模式的全部响应
+mcp_call() {
+    printf '%s\n' "$@" | "$CLIENT" -socket "$SOCKET_PATH" mcp
+}
+
+# 测试: initialize 与 tools/list 不需要 server
+log_info "测试: initialize 和 tools/list"
+OUTPUT=$(mcp_call \
+    '{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}' \
+    '{"jsonrpc":"2.0","method":"notifications/initialized"}' \
+    '{"jsonrpc":"2.0","id":2,"method":"tools/list"}')
+if echo "$OUTPUT" | grep -q '"protocolVersion":"2024-11-05"' && echo "$OUTPUT" | grep -q '"tools":{}'; then
+    log_pass "initialize 返回协议版本和 tools 能力"
+else
+    log_fail "initialize 响应不正确: $OUTPUT"
+    FAILED=1
+fi
+for TOOL in create_session send_prompt wait get_output get_messages approve_permission delete_session; do
+    if ! echo "$OUTPUT" | grep -q "\"name\":\"$TOOL\""; then
+        log_fail "tools/list 缺少 $TOOL"
+        FAILED=1
+    fi
+done
+[ $FAILED -eq 0 ] && log_pass "tools/list 包含全部工具"
+
+# 测试: 未知方法和无效 JSON 返回 JSON-RPC 错误
+log_info "测试: 未知方法与解析错误"
+OUTPUT=$(mcp_call '{"jsonrpc":"2.0","id":3,"method":"bogus"}' 'not json')
+if echo "$OUTPUT" | grep -q '"code":-32601' && echo "$OUTPUT" | grep -q '"code":-32700'; then
+    log_pass "返回 -32601 和 -32700"
+else
+    log_fail "错误响应不正确: $OUTPUT"
+    FAILED=1
+fi
+
+# 测试: 工具失败作为 isError 结果返回并带错误码（需要 server）
+if [ -S "$SOCKET_PATH" ]; then
+    log_info "测试: 不存在的会话"
+    OUTPUT=$(mcp_call '{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"get_output","arguments":{"session_id":"nonexistent"}}}')
+    if echo "$OUTPUT" | grep -q '"isError":true' && echo "$OUTPUT" | grep -q 'SESSION_NOT_FOUND'; then
+        log_pass "返回 isError 和 SESSION_NOT_FOUND"
+    else
+        log_fail "工具错误不正确: $OUTPUT"
+        FAILED=1
+    fi
+else
+    log_info "Server 未运行，跳过工具调用测试"
+fi
+
+exit $FAILED
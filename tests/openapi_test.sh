@@ -0,0 +1,43 @@
+#!/bin/bash
+# OpenAPI 文档同步测试：api/openapi.json 必须与 protocol.go 等生成的结果一致
+
+SOCKET_PATH="${CLAUDE_PTY_SOCKET:-/run/user/1000/claude-pty.sock}"
+ROOT_DIR="$(cd "$(dirname "$0")/.." && pwd)"
+
+log_info() {
+    echo "[INFO] $1"
+}
+
+log_pass() {
+    echo "[PASS] $1"
+}
+
+log_fail() {
+    echo "[FAIL] $1"
+}
+
+FAILED=0
+
+# 测试: 已提交的 api/openapi.json 是最新的
+log_info "测试: api/openapi.json 与代码同步"
+if (cd "$ROOT_DIR" && go run ./cmd/openapi-gen -check); then
+    log_pass "api/openapi.json 是最新的"
+else
+    log_fail "api/openapi.json 已过期，请运行 go run ./cmd/openapi-gen 重新生成"
+    FAILED=1
+fi
+
+# 测试: 运行中的 server 返回相同的文档（server 未运行时跳过）
+if [ -S "$SOCKET_PATH" ]; then
+    log_info "测试: /openapi.json 与 api/openapi.json 一致"
+    if curl -s --unix-socket "$SOCKET_PATH" http://localhost/openapi.json | cmp -s - "$ROOT_DIR/api/openapi.json"; then
+        log_pass "/openapi.json 一致"
+    else
+        log_fail "/openapi.json 与 api/openapi.json 不一致（server 是否为旧版本？）"
+        FAILED=1
+    fi
+else
+    log_info "Server 未运行，跳过 /openapi.json 测试"
+fi
+
+exit $FAILED
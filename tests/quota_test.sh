@@ -0,0 +1,95 @@
+#!/bin/bash
+# 配额测试：启动一个独立的 server（临时 socket），检查输入和请求体大小限制、TCP 创建速率限制和 quotas 接口
+
+ROOT_DIR="$(cd "$(dirname "$0")/.." && pwd)"
+PORT="${CLAUDE_PTY_TEST_PORT:-17682}"
+BASE_URL="http://127.0.0.1:$PORT"
+
+log_info() {
+    echo "[INFO] $1"
+}
+
+log_pass() {
+    echo "[PASS] $1"
+}
+
+log_fail() {
+    echo "[FAIL] $1"
+}
+
+FAILED=0
+WORK_DIR="$(mktemp -d)"
+SERVER_PID=""
+cleanup() {
+    [ -n "$SERVER_PID" ] && kill "$SERVER_PID" 2>/dev/null && wait "$SERVER_PID" 2>/dev/null
+    rm -rf "$WORK_DIR"
+}
+trap cleanup EXIT
+
+INPUT_TOKEN="input-token-$(date +%s%N)"
+cat > "$WORK_DIR/tokens.json" <<JSON
+{"tokens": [{"name": "driver", "token": "$INPUT_TOKEN", "scope": "input"}]}
+JSON
+
+if ! (cd "$ROOT_DIR" && go build -o "$WORK_DIR/server" ./cmd/server); then
+    log_fail "编译 server 失败"
+    exit 1
+fi
+"$WORK_DIR/server" -socket "$WORK_DIR/test.sock" -listen ":$PORT" -tokens "$WORK_DIR/tokens.json" -audit-log off \
+    -max-input-size 16 -creates-per-minute 1 > "$WORK_DIR/server.log" 2>&1 &
+SERVER_PID=$!
+sleep 1
+
+SOCKET="$WORK_DIR/test.sock"
+
+# 测试: 超过 -max-input-size 的输入被拒绝
+log_info "测试: 输入大小限制"
+STATUS=$(curl -s -o "$WORK_DIR/resp.json" -w "%{http_code}" --unix-socket "$SOCKET" -X POST \
+    http://localhost/sessions/nonexistent/submit -d '{"text":"0123456789abcdefXYZ"}')
+if [ "$STATUS" = "413" ] && grep -q '"code":"INPUT_TOO_LARGE"' "$WORK_DIR/resp.json"; then
+    log_pass "返回 413 INPUT_TOO_LARGE"
+else
+    log_fail "期望 413 INPUT_TOO_LARGE，实际 $STATUS: $(cat "$WORK_DIR/resp.json")"
+    FAILED=1
+fi
+
+# 测试: 请求体超过上限（-max-input-size 的 6 倍加 64 KiB）时在解析前被拒绝
+log_info "测试: 请求体大小限制"
+head -c 70000 /dev/zero | tr '\0' 'x' | sed 's/^/{"action":"list","padding":"/; s/$/"}/' > "$WORK_DIR/big.json"
+STATUS=$(curl -s -o "$WORK_DIR/resp.json" -w "%{http_code}" --unix-socket "$SOCKET" -X POST \
+    http://localhost/ --data-binary @"$WORK_DIR/big.json")
+if [ "$STATUS" = "413" ] && grep -q '"code":"INPUT_TOO_LARGE"' "$WORK_DIR/resp.json"; then
+    log_pass "返回 413 INPUT_TOO_LARGE"
+else
+    log_fail "期望 413 INPUT_TOO_LARGE，实际 $STATUS: $(cat "$WORK_DIR/resp.json")"
+    FAILED=1
+fi
+
+# 测试: 同一 token 每分钟只能创建一次（按创建尝试计数，第一次即使 claude 启动失败也会计入）
+log_info "测试: 创建速率限制"
+curl -s -o /dev/null -H "Authorization: Bearer $INPUT_TOKEN" -X POST "$BASE_URL/sessions" -d '{"cwd":"/tmp"}'
+RESPONSE=$(curl -s -w " %{http_code}" -H "Authorization: Bearer $INPUT_TOKEN" -X POST "$BASE_URL/sessions" -d '{"cwd":"/tmp"}')
+if echo "$RESPONSE" | grep -q '"code":"QUOTA_EXCEEDED".* 429$'; then
+    log_pass "返回 429 QUOTA_EXCEEDED"
+else
+    log_fail "期望 429 QUOTA_EXCEEDED: $RESPONSE"
+    FAILED=1
+fi
+
+# 测试: quotas 需要管理员权限，返回配额和每个调用方的用量
+log_info "测试: quotas 接口"
+STATUS=$(curl -s -o /dev/null -w "%{http_code}" -H "Authorization: Bearer $INPUT_TOKEN" "$BASE_URL/quotas")
+RESPONSE=$(curl -s --unix-socket "$SOCKET" http://localhost/quotas)
+if [ "$STATUS" = "403" ] && echo "$RESPONSE" | grep -q '"max_input_bytes":16' && echo "$RESPONSE" | grep -q '"caller":"token:driver"'; then
+    log_pass "token 返回 403，Unix socket 返回用量"
+else
+    log_fail "quotas 结果不符: $STATUS $RESPONSE"
+    FAILED=1
+fi
+
+# 清理测试中可能创建的会话
+for ID in $(curl -s --unix-socket "$SOCKET" http://localhost/sessions | grep -o '"id":"[^"]*"' | cut -d'"' -f4); do
+    curl -s -o /dev/null --unix-socket "$SOCKET" -X DELETE "http://localhost/sessions/$ID"
+done
+
+exit $FAILED